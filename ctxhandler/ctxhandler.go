@@ -3,55 +3,172 @@ package ctxhandler
 import (
 	"context"
 	"log/slog"
+	"reflect"
 	"slices"
+	"sync/atomic"
 
 	"github.com/croepha/go-logging-extras/logctx"
 )
 
+// Options for NewHandler, the zero value is valid
+type HandlerOptions struct {
+	// Called for each record, the returned attributes are added to the record
+	// For values other libraries keep in the context, ie: the auth principal or the deadline
+	Extractors []func(ctx context.Context) []slog.Attr
+
+	// Used when the context doesn't have a handler and no logctx fallback (see logctx.AddFallback)
+	// finds one, defaults to logctx.Handler which uses the logctx default handler
+	Fallback slog.Handler
+}
+
 // Create a new handler instance
 // This handler simply uses the supplied ctx to check for a Handler and uses it
 // This handler can be used directly or installed as slog.Default()
 // and provides compatibility for existing code that calls slog.InfoContext() or
 // similar to use the logging handler configured in the ctx
-func NewHandler() *ctxHandler {
-	return &ctxHandler{}
+// opts may be nil
+func NewHandler(opts *HandlerOptions) *ctxHandler {
+	h := &ctxHandler{}
+	if opts != nil {
+		h.extractors = slices.Clone(opts.Extractors)
+		h.fallback = opts.Fallback
+	}
+	return h
 }
 
 type ctxHandler struct {
-	attrs  []slog.Attr
-	groups []string
+	extractors []func(ctx context.Context) []slog.Attr
+	fallback   slog.Handler
+
+	ops      []op // WithAttrs and WithGroup calls, in order
+	hasGroup bool
+	cache    *derivedCache
 }
 
+// Either attrs or group is set
+type op struct {
+	attrs []slog.Attr
+	group string
+}
 
 func (ctxHandler) CannotBeLogCtxHandler() {}
 
-func handler(ctx context.Context) slog.Handler {
+func (h *ctxHandler) handler(ctx context.Context) slog.Handler {
+	if v, ok := logctx.Lookup(ctx); ok {
+		return v
+	}
+	if h.fallback != nil {
+		return h.fallback
+	}
 	return logctx.Handler(ctx)
 }
 
 func (h *ctxHandler) Enabled(ctx context.Context, l slog.Level) bool {
-	return handler(ctx).Enabled(ctx, l)
+	return h.handler(ctx).Enabled(ctx, l)
 }
 
 func (h *ctxHandler) Handle(ctx context.Context, r slog.Record) error {
-	real := handler(ctx)
-	if len(h.attrs) > 0 {
-		real = real.WithAttrs(h.attrs)
+	base := h.handler(ctx)
+
+	var extracted []slog.Attr
+	for _, e := range h.extractors {
+		extracted = append(extracted, e(ctx)...)
+	}
+	switch {
+	case len(extracted) == 0:
+		return h.derive(base).Handle(ctx, r)
+	case !h.hasGroup:
+		r = r.Clone()
+		r.AddAttrs(extracted...)
+		return h.derive(base).Handle(ctx, r)
+	default:
+		// Keep the extracted attributes out of the groups, can't be cached
+		return applyOps(base.WithAttrs(extracted), h.ops).Handle(ctx, r)
+	}
+}
+
+// Applies ops to base, the result is cached because WithAttrs can be expensive,
+// ie: slog.JSONHandler preformats the attributes
+func (h *ctxHandler) derive(base slog.Handler) slog.Handler {
+	if len(h.ops) == 0 {
+		return base
+	}
+	if d := h.cache.get(base); d != nil {
+		return d
+	}
+	d := applyOps(base, h.ops)
+	h.cache.put(base, d)
+	return d
+}
+
+func applyOps(h slog.Handler, ops []op) slog.Handler {
+	for _, o := range ops {
+		if o.group != "" {
+			h = h.WithGroup(o.group)
+		} else {
+			h = h.WithAttrs(o.attrs)
+		}
+	}
+	return h
+}
+
+// Number of derived handlers kept per ctxHandler, usually a logger is used with
+// contexts that share a few handlers, ie: the default handler
+const cacheSize = 8
+
+// Lock free, entries are replaced round robin
+type derivedCache struct {
+	entries [cacheSize]atomic.Pointer[cacheEntry]
+	next    atomic.Uint32
+}
+
+type cacheEntry struct {
+	base, derived slog.Handler
+}
+
+// Only comparable bases are cached, comparing them with the cached ones can't panic
+// The static type isn't enough, a comparable struct can hold an uncomparable handler
+func cacheable(base slog.Handler) bool {
+	return reflect.ValueOf(base).Comparable()
+}
+
+func (c *derivedCache) get(base slog.Handler) slog.Handler {
+	if !cacheable(base) {
+		return nil
+	}
+	for i := range c.entries {
+		if e := c.entries[i].Load(); e != nil && e.base == base {
+			return e.derived
+		}
 	}
-	for _, g := range h.groups {
-		real = real.WithGroup(g)
+	return nil
+}
+
+func (c *derivedCache) put(base, derived slog.Handler) {
+	if !cacheable(base) {
+		return
 	}
-	return real.Handle(ctx, r)
+	i := (c.next.Add(1) - 1) % cacheSize
+	c.entries[i].Store(&cacheEntry{base: base, derived: derived})
 }
 
 func (h *ctxHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
 	r := *h
-	r.attrs = slices.Concat(r.attrs, attrs)
+	r.ops = slices.Concat(h.ops, []op{{attrs: slices.Clone(attrs)}})
+	r.cache = &derivedCache{}
 	return &r
 }
 
 func (h *ctxHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
 	r := *h
-	r.groups = slices.Concat(r.groups, []string{name})
+	r.ops = slices.Concat(h.ops, []op{{group: name}})
+	r.hasGroup = true
+	r.cache = &derivedCache{}
 	return &r
 }
@@ -1,13 +1,17 @@
 package ctxhandler_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"log/slog"
 	"testing"
+	"testing/slogtest"
 
 	"github.com/croepha/go-logging-extras/ctxhandler"
 	"github.com/croepha/go-logging-extras/logctx"
 	"github.com/croepha/go-logging-extras/logtest"
+	"github.com/stretchr/testify/require"
 )
 
 func Test(t *testing.T) {
@@ -17,7 +21,7 @@ func Test(t *testing.T) {
 
 	ctx = logctx.Context(ctx, handler)
 
-	l := slog.New(ctxhandler.NewHandler())
+	l := slog.New(ctxhandler.NewHandler(nil))
 
 	l.InfoContext(ctx, "info test", "attr0", "foo")
 	th.RequireLine(slog.LevelInfo, "info test", "attr0", "foo")
@@ -29,3 +33,137 @@ func Test(t *testing.T) {
 	th.RequireLine(slog.LevelInfo, "info test", "withGroup0", map[string]any{"attr0": "foo"})
 
 }
+
+func TestDerivedCache(t *testing.T) {
+	l := slog.New(ctxhandler.NewHandler(nil)).With("with0", "with0")
+
+	// More handlers than are cached, each still gets its own output
+	var bufs [20]bytes.Buffer
+	var ctxs [20]context.Context
+	for i := range ctxs {
+		ctxs[i] = logctx.Attr(logctx.Context(context.Background(), slog.NewJSONHandler(&bufs[i], nil)), "i", i)
+	}
+	for range 3 {
+		for i, ctx := range ctxs {
+			l.InfoContext(ctx, "cache test")
+			m := map[string]any{}
+			require.NoError(t, json.Unmarshal(bufs[i].Bytes(), &m))
+			require.Equal(t, float64(i), m["i"])
+			require.Equal(t, "with0", m["with0"])
+			bufs[i].Reset()
+		}
+	}
+
+	ctx := ctxs[0]
+	require.Zero(t, testing.AllocsPerRun(100, func() {
+		l.LogAttrs(ctx, slog.LevelDebug, "not logged")
+	}))
+}
+
+// A value handler that can't be compared
+type sliceHandler struct {
+	slog.Handler
+	tags []string
+}
+
+// Comparable type, but holds an uncomparable handler
+type valueHandler struct {
+	slog.Handler
+}
+
+func TestUncomparableHandler(t *testing.T) {
+	th := logtest.NewTestHandler(t)
+	ctx := logctx.Context(context.Background(), valueHandler{sliceHandler{Handler: th.H}})
+
+	l := slog.New(ctxhandler.NewHandler(nil)).With("with0", "with0")
+	for range 2 {
+		l.InfoContext(ctx, "uncomparable test")
+		th.RequireLine(slog.LevelInfo, "uncomparable test", "with0", "with0")
+	}
+}
+
+type principalKey struct{}
+
+func TestExtractors(t *testing.T) {
+	th := logtest.NewTestHandler(t)
+	fallback := logtest.NewTestHandler(t)
+
+	l := slog.New(ctxhandler.NewHandler(&ctxhandler.HandlerOptions{
+		Extractors: []func(context.Context) []slog.Attr{func(ctx context.Context) []slog.Attr {
+			if p, ok := ctx.Value(principalKey{}).(string); ok {
+				return []slog.Attr{slog.String("principal", p)}
+			}
+			return nil
+		}},
+		Fallback: fallback.H,
+	}))
+
+	ctx := context.WithValue(logctx.Context(context.Background(), th.H), principalKey{}, "alice")
+	l.InfoContext(ctx, "extract test", "attr0", "foo")
+	th.RequireLine(slog.LevelInfo, "extract test", "attr0", "foo", "principal", "alice")
+
+	l.WithGroup("g").With("with0", "with0").InfoContext(ctx, "extract test", "attr0", "foo")
+	th.RequireLine(slog.LevelInfo, "extract test", "principal", "alice", "g", map[string]any{"with0": "with0", "attr0": "foo"})
+
+	l.InfoContext(context.Background(), "fallback test")
+	fallback.RequireLine(slog.LevelInfo, "fallback test")
+	th.RequireEOF()
+
+	// logctx fallbacks are tried first, like logctx.Info does
+	foreign := logtest.NewTestHandler(t)
+	t.Cleanup(logctx.AddFallback(func(ctx context.Context) (slog.Handler, bool) {
+		h, ok := ctx.Value(foreignLoggerKey{}).(slog.Handler)
+		return h, ok
+	}))
+	ctx = context.WithValue(context.Background(), foreignLoggerKey{}, foreign.H)
+	l.InfoContext(ctx, "foreign test")
+	foreign.RequireLine(slog.LevelInfo, "foreign test")
+	fallback.RequireEOF()
+}
+
+// Where another library keeps its context logger
+type foreignLoggerKey struct{}
+
+func TestWithLevel(t *testing.T) {
+	ctx := context.Background()
+	th := logtest.NewTestHandler(t)
+
+	ctx = logctx.WithLevel(logctx.Context(ctx, th.H), slog.LevelDebug)
+
+	l := slog.New(ctxhandler.NewHandler(nil))
+
+	l.DebugContext(ctx, "debug test", "attr0", "foo")
+	th.RequireLine(slog.LevelDebug, "debug test", "attr0", "foo")
+
+	l.DebugContext(context.Background(), "not logged")
+	th.RequireEOF()
+}
+
+func TestContextGroup(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := logctx.Context(context.Background(), slog.NewJSONHandler(&buf, nil))
+	ctx = logctx.Group(ctx, "job")
+	ctx = logctx.Attr(ctx, "attr0", "foo")
+
+	// Records are logged with a context that has a group open
+	l := slog.New(ctxhandler.NewHandler(nil))
+	l.WithGroup("withGroup0").With("with0", "with0").InfoContext(ctx, "info test", "attr1", "bar")
+	m := map[string]any{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &m))
+	require.Equal(t, map[string]any{"attr0": "foo", "withGroup0": map[string]any{"with0": "with0", "attr1": "bar"}}, m["job"])
+}
+
+func TestSlogtest(t *testing.T) {
+	var buf bytes.Buffer
+	defer logctx.SetDefaultHandler(logctx.Default().DefaultHandler())
+
+	slogtest.Run(t, func(*testing.T) slog.Handler {
+		buf.Reset()
+		logctx.SetDefaultHandler(slog.NewJSONHandler(&buf, nil))
+		return ctxhandler.NewHandler(nil)
+	}, func(t *testing.T) map[string]any {
+		m := map[string]any{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &m))
+		return m
+	})
+}
@@ -73,8 +73,7 @@ func RawDetailer(err error) Details {
 	return err
 }
 
-// TODO: Also kinda would be nice to reflect all the struct members, some
-// errors have details/codes are hidden away as private members
+// Some errors have details/codes hidden away as private members, see NewPrivateFieldsDetailer
 
 func ReflectionDetailer(next Detailer) Detailer {
 	return func(err error) Details {
@@ -104,8 +103,9 @@ type slogValue struct {
 	err error
 }
 
+// The details are converted to nested groups, see detailsValue
 func (v *slogValue) LogValue() slog.Value {
-	return slog.AnyValue(GlobalDetailer(v.err))
+	return detailsValue(GlobalDetailer(v.err))
 }
 
 func NewSlog(name string, err error) slog.Attr {
@@ -1,14 +1,22 @@
 package errordump_test
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"slices"
+	"sync"
 	"syscall"
 	"testing"
+	"time"
 
 	"github.com/croepha/go-logging-extras/errordump"
 	"github.com/croepha/go-logging-extras/logtest"
+	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -47,12 +55,11 @@ func Test(t *testing.T) {
 	logger.ErrorContext(ctx, "error", errordump.NewSlog("error", e))
 	th.RequireLine(slog.LevelError, "error", "error", o{
 		"Error": o{
-			"NextDetails":          o{},
 			"ReflectedName":        "wrapErrors",
 			"ReflectedPackagePath": "fmt",
 			"String":               "wrap test: rpc error: code = Aborted desc = asdf test wrap test: argument list too long",
-		}, "WrappedErrors": []o{
-			{
+		}, "WrappedErrors": o{
+			"0": o{
 				"NextDetails": o{
 					"code": 10, "message": "asdf",
 				},
@@ -60,15 +67,13 @@ func Test(t *testing.T) {
 				"ReflectedPackagePath": "google.golang.org/grpc/internal/status",
 				"String":               "rpc error: code = Aborted desc = asdf",
 			},
-			{
-				"NextDetails":          o{},
+			"1": o{
 				"ReflectedName":        "errorString",
 				"ReflectedPackagePath": "errors",
 				"String":               "test",
 			},
-			{
+			"2": o{
 				"Error": o{
-					"NextDetails":          o{},
 					"ReflectedName":        "wrapError",
 					"ReflectedPackagePath": "fmt",
 					"String":               "wrap test: argument list too long"},
@@ -82,3 +87,106 @@ func Test(t *testing.T) {
 		},
 	})
 }
+
+func TestNativeGroups(t *testing.T) {
+	errordump.GlobalDetailer = errordump.NewUnwrappingDetailer(errordump.ReflectionDetailer(errordump.RawDetailer))
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			if slices.Equal(groups, []string{"error", "Error", "NextDetails"}) && a.Key == "Path" {
+				return slog.String(a.Key, "REDACTED")
+			}
+			return a
+		},
+	}))
+
+	_, err := os.Stat("/does/not/exist")
+	logger.Error("stat", errordump.NewSlog("error", err))
+	require.Equal(t, `level=ERROR msg=stat `+
+		`error.Error.String="stat /does/not/exist: no such file or directory" error.Error.ReflectedName=PathError `+
+		`error.Error.ReflectedPackagePath=io/fs error.Error.NextDetails.Op=stat error.Error.NextDetails.Path=REDACTED `+
+		`error.Error.NextDetails.Err=2 `+
+		`error.WrappedError.String="no such file or directory" error.WrappedError.ReflectedName=Errno `+
+		`error.WrappedError.ReflectedPackagePath=syscall error.WrappedError.NextDetails=2`+"\n", buf.String())
+}
+
+type privateCode struct {
+	code   int
+	reason string
+}
+
+type privateError struct {
+	mu      sync.Mutex
+	msg     string
+	detail  privateCode
+	retry   func()
+	tags    map[string]int
+	raw     []byte
+	secret  string
+	self    *privateError
+	wrapped error
+	at      time.Time
+	when    any
+	ip      net.IP
+	n       big.Int
+}
+
+func (e *privateError) Error() string { return e.msg }
+
+func TestPrivateFieldsDetailer(t *testing.T) {
+	th := logtest.NewTestHandler(t)
+	logger := slog.New(th.H)
+
+	errordump.GlobalDetailer = errordump.ReflectionDetailer(errordump.ChainDetailers(
+		errordump.NewPrivateFieldsDetailer(&errordump.PrivateFieldsOptions{DenyFields: []string{"secret"}}),
+		errordump.RawDetailer,
+	))
+
+	e := &privateError{
+		msg:     "private test",
+		detail:  privateCode{code: 42, reason: "quota"},
+		retry:   func() {},
+		tags:    map[string]int{"b": 2, "a": 1},
+		raw:     []byte{0xca, 0xfe},
+		secret:  "hunter2",
+		wrapped: syscall.E2BIG,
+		at:      time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		when:    time.Date(2024, 1, 2, 3, 4, 6, 0, time.UTC),
+		ip:      net.IPv4(192, 0, 2, 1),
+	}
+	e.self = e
+	e.n.SetInt64(12345)
+
+	type o = map[string]any
+	logger.Error("error", errordump.NewSlog("error", e))
+	th.RequireLine(slog.LevelError, "error", "error", o{
+		"String":               "private test",
+		"ReflectedName":        "privateError",
+		"ReflectedPackagePath": "github.com/croepha/go-logging-extras/errordump_test",
+		"NextDetails": o{
+			"msg":     "private test",
+			"detail":  o{"code": 42, "reason": "quota"},
+			"tags":    o{"a": 1, "b": 2},
+			"raw":     "cafe",
+			"self":    "<cycle>",
+			"wrapped": 7,
+			"at":      "2024-01-02T03:04:05Z",
+			"when":    "2024-01-02T03:04:06Z",
+			"ip":      "192.0.2.1",
+			"n":       12345,
+		},
+	})
+
+	// Errors without fields fall through
+	logger.Error("error", errordump.NewSlog("error", syscall.E2BIG))
+	th.RequireLine(slog.LevelError, "error", "error", o{
+		"String":               "argument list too long",
+		"ReflectedName":        "Errno",
+		"ReflectedPackagePath": "syscall",
+		"NextDetails":          7,
+	})
+}
@@ -0,0 +1,193 @@
+package errordump
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// Options for NewPrivateFieldsDetailer, the zero value is valid
+type PrivateFieldsOptions struct {
+	// How deep to walk nested values, deeper values are formatted with fmt, defaults to 4
+	MaxDepth int
+
+	// Max number of elements output for slices and maps, defaults to 32
+	MaxElements int
+
+	// Names of fields to skip, in addition to the fields of types that can't be
+	// useful in logs like funcs, channels and the types from sync and sync/atomic
+	DenyFields []string
+}
+
+// Returns a detailer that walks all the fields of errors, including unexported ones, so that
+// codes hidden away in third-party error types show up in logs.  Values with a JSON or text
+// marshaler or a LogValue method, ie: time.Time, are output with it.  Pointer cycles are output
+// as "<cycle>".  Returns nil for errors that don't have fields, so it can be used with ChainDetailers
+// opts may be nil
+func NewPrivateFieldsDetailer(opts *PrivateFieldsOptions) Detailer {
+	w := privateWalker{maxDepth: 4, maxElements: 32}
+	if opts != nil {
+		if opts.MaxDepth > 0 {
+			w.maxDepth = opts.MaxDepth
+		}
+		if opts.MaxElements > 0 {
+			w.maxElements = opts.MaxElements
+		}
+		w.denyFields = slices.Clone(opts.DenyFields)
+	}
+	return func(err error) Details {
+		v, seen := reflect.ValueOf(err), map[uintptr]bool{}
+		for v.Kind() == reflect.Pointer && !v.IsNil() {
+			seen[v.Pointer()] = true
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			return nil
+		}
+		attrs := w.fields(reachable(v), 0, seen)
+		if len(attrs) == 0 {
+			return nil
+		}
+		return privateFields(attrs)
+	}
+}
+
+// Already converted, see detailsValue
+type privateFields []slog.Attr
+
+func (p privateFields) LogValue() slog.Value {
+	return slog.GroupValue(p...)
+}
+
+type privateWalker struct {
+	maxDepth    int
+	maxElements int
+	denyFields  []string
+}
+
+var denyPackages = []string{"sync", "sync/atomic", "unsafe"}
+
+// Returns false for values that shouldn't be output
+func (w *privateWalker) value(v reflect.Value, depth int, seen map[uintptr]bool) (slog.Value, bool) {
+	switch v.Kind() {
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer, reflect.Invalid:
+		return slog.Value{}, false
+	}
+	if slices.Contains(denyPackages, v.Type().PkgPath()) {
+		return slog.Value{}, false
+	}
+	v = reachable(v)
+	if t := v.Type(); v.CanInterface() && marshals(t) {
+		if (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && v.IsNil() {
+			return slog.AnyValue(nil), true
+		}
+		return slog.AnyValue(v.Interface()), true
+	} else if v.CanInterface() && v.CanAddr() && marshals(reflect.PointerTo(t)) {
+		return slog.AnyValue(v.Addr().Interface()), true // ie: big.Int
+	}
+	if depth >= w.maxDepth {
+		return slog.StringValue(fmt.Sprint(v)), true
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return slog.AnyValue(nil), true
+		}
+		p := v.Pointer()
+		if seen[p] {
+			return slog.StringValue("<cycle>"), true
+		}
+		seen[p] = true
+		defer delete(seen, p) // Only cycles on the current path
+		return w.value(v.Elem(), depth, seen)
+	case reflect.Interface:
+		if v.IsNil() {
+			return slog.AnyValue(nil), true
+		}
+		return w.value(v.Elem(), depth, seen)
+	case reflect.Bool:
+		return slog.BoolValue(v.Bool()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return slog.Int64Value(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return slog.Uint64Value(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return slog.Float64Value(v.Float()), true
+	case reflect.Complex64, reflect.Complex128:
+		return slog.StringValue(fmt.Sprint(v)), true
+	case reflect.String:
+		return slog.StringValue(v.String()), true
+	case reflect.Struct:
+		return slog.GroupValue(w.fields(v, depth, seen)...), true
+	case reflect.Map:
+		var attrs []slog.Attr
+		iter := v.MapRange()
+		for iter.Next() {
+			if len(attrs) >= w.maxElements {
+				attrs = append(attrs, slog.Int("truncated", v.Len()-w.maxElements))
+				break
+			}
+			if ev, ok := w.value(iter.Value(), depth+1, seen); ok {
+				attrs = append(attrs, slog.Attr{Key: fmt.Sprint(iter.Key()), Value: ev})
+			}
+		}
+		slices.SortFunc(attrs, func(a, b slog.Attr) int { return strings.Compare(a.Key, b.Key) })
+		return slog.GroupValue(attrs...), true
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return slog.StringValue(fmt.Sprintf("%x", v)), true
+		}
+		var attrs []slog.Attr
+		for i := range v.Len() {
+			if i >= w.maxElements {
+				attrs = append(attrs, slog.Int("truncated", v.Len()-w.maxElements))
+				break
+			}
+			if ev, ok := w.value(v.Index(i), depth+1, seen); ok {
+				attrs = append(attrs, slog.Attr{Key: strconv.Itoa(i), Value: ev})
+			}
+		}
+		return slog.GroupValue(attrs...), true
+	}
+	return slog.Value{}, false
+}
+
+func marshals(t reflect.Type) bool {
+	return t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) || t.Implements(logValuerType)
+}
+
+// Returns v as a value that can be interfaced, so that the methods of unexported fields like
+// time.Time can be used.  Unexported values are accessed at their address, and struct and array
+// values that aren't addressable are copied so that their fields are addressable too.  The walk
+// starts from an addressable value, so every value reached this way can be interfaced.
+func reachable(v reflect.Value) reflect.Value {
+	switch {
+	case !v.CanInterface() && v.CanAddr():
+		return reflect.NewAt(v.Type(), unsafe.Pointer(v.UnsafeAddr())).Elem()
+	case v.CanInterface() && !v.CanAddr() && (v.Kind() == reflect.Struct || v.Kind() == reflect.Array):
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		return c
+	}
+	return v
+}
+
+func (w *privateWalker) fields(v reflect.Value, depth int, seen map[uintptr]bool) []slog.Attr {
+	var attrs []slog.Attr
+	t := v.Type()
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if f.Name == "_" || slices.Contains(w.denyFields, f.Name) {
+			continue
+		}
+		if fv, ok := w.value(v.Field(i), depth+1, seen); ok {
+			attrs = append(attrs, slog.Attr{Key: f.Name, Value: fv})
+		}
+	}
+	return attrs
+}
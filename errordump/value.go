@@ -0,0 +1,122 @@
+package errordump
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Nesting deeper than this is output with slog.AnyValue
+const maxValueDepth = 16
+
+// Converts details to nested slog.GroupValues, so handlers render them natively and
+// ReplaceAttr sees the individual fields.  Structs use their exported fields named like
+// encoding/json would, maps use their keys, and slices use the index as the key.
+// Values that marshal themselves or implement slog.LogValuer are kept as they are
+func detailsValue(d Details) slog.Value {
+	return reflectValue(reflect.ValueOf(d), 0)
+}
+
+var (
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+	logValuerType     = reflect.TypeFor[slog.LogValuer]()
+)
+
+func reflectValue(v reflect.Value, depth int) slog.Value {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return slog.AnyValue(nil)
+		}
+		if t := v.Type(); v.Kind() == reflect.Pointer &&
+			(t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) || t.Implements(logValuerType)) {
+			return slog.AnyValue(v.Interface())
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return slog.AnyValue(nil)
+	}
+	if t := v.Type(); t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) || t.Implements(logValuerType) {
+		return slog.AnyValue(v.Interface())
+	}
+	if depth >= maxValueDepth {
+		if v.CanInterface() {
+			return slog.AnyValue(v.Interface())
+		}
+		return slog.StringValue(fmt.Sprint(v))
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return slog.BoolValue(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return slog.Int64Value(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return slog.Uint64Value(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return slog.Float64Value(v.Float())
+	case reflect.String:
+		return slog.StringValue(v.String())
+	case reflect.Struct:
+		return slog.GroupValue(structAttrs(v, depth)...)
+	case reflect.Map:
+		attrs := make([]slog.Attr, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			attrs = append(attrs, slog.Attr{Key: fmt.Sprint(k.Interface()), Value: reflectValue(v.MapIndex(k), depth+1)})
+		}
+		slices.SortFunc(attrs, func(a, b slog.Attr) int { return strings.Compare(a.Key, b.Key) })
+		return slog.GroupValue(attrs...)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			return slog.AnyValue(v.Interface()) // []byte, like encoding/json
+		}
+		attrs := make([]slog.Attr, v.Len())
+		for i := range v.Len() {
+			attrs[i] = slog.Attr{Key: strconv.Itoa(i), Value: reflectValue(v.Index(i), depth+1)}
+		}
+		return slog.GroupValue(attrs...)
+	default:
+		return slog.AnyValue(nil) // Funcs and chans, encoding/json can't output them either
+	}
+}
+
+// Exported fields, named and omitted like encoding/json would
+func structAttrs(v reflect.Value, depth int) []slog.Attr {
+	var attrs []slog.Attr
+	t := v.Type()
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fv := v.Field(i)
+		if strings.Contains(","+opts+",", ",omitempty,") && isEmptyValue(fv) {
+			continue
+		}
+		attrs = append(attrs, slog.Attr{Key: name, Value: reflectValue(fv, depth+1)})
+	}
+	return attrs
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return v.IsZero()
+}
@@ -3,6 +3,7 @@ package internal
 import (
 	"context"
 	"log/slog"
+	"reflect"
 )
 
 func (h *NullHandler) Enabled(_ context.Context, _ slog.Level) bool {
@@ -23,3 +24,32 @@ func (h *NullHandler) WithGroup(name string) slog.Handler {
 
 type NullHandler struct {
 }
+
+// Longer incoming request IDs are replaced
+const MaxRequestIDLength = 128
+
+// Incoming request IDs (loghttp, loggrpc) end up in every record, response headers and
+// outgoing requests, so only IDs made of letters, digits and "-_.:" are accepted
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > MaxRequestIDLength {
+		return false
+	}
+	for _, c := range []byte(id) {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Reports if a and b are the same handler, without panicking on uncomparable handlers
+// The static type isn't enough, a comparable struct can hold an uncomparable handler
+func SameHandler(a, b slog.Handler) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return reflect.ValueOf(a).Comparable() && reflect.ValueOf(b).Comparable() && a == b
+}
@@ -86,7 +86,7 @@ func (l L) Handler(ctx context.Context) slog.Handler {
 
 // Gives a new ctx that has a handler with these attributes
 func (l L) Context(ctx context.Context) context.Context {
-	return logctx.Context(ctx, l.Handler(ctx))
+	return logctx.WithAttrs(ctx, l.resolveAttrs()...)
 }
 
 // handles a new log record
@@ -203,7 +203,7 @@ func (sgh Sugar) Handler(ctx context.Context) slog.Handler { return sgh.c.Handle
 
 // Gives a new ctx that has a handler with these attributes
 func (sgh Sugar) Context(ctx context.Context) context.Context {
-	return logctx.Context(ctx, sgh.Handler(ctx))
+	return logctx.WithAttrs(ctx, sgh.c.resolveAttrs()...)
 }
 
 // Gives a new ctx that has a handler with these attributes
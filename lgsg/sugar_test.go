@@ -2,13 +2,16 @@ package lgsg_test
 
 import (
 	"context"
+	"io"
 	"log/slog"
 	"testing"
 
+	"github.com/croepha/go-logging-extras/ctxhandler"
 	"github.com/croepha/go-logging-extras/internal"
 	"github.com/croepha/go-logging-extras/lgsg"
 	"github.com/croepha/go-logging-extras/logctx"
 	"github.com/croepha/go-logging-extras/logtest"
+	"github.com/stretchr/testify/require"
 )
 
 var l lgsg.L
@@ -67,3 +70,34 @@ func BenchmarkBaselineAttrs(b *testing.B) {
 		logger.LogAttrs(ctx, slog.LevelInfo, "test line", slog.Int("bench_i", i))
 	}
 }
+
+// Logging with slog.With through the compatibility handler, compare with BenchmarkDirectWith
+func BenchmarkCtxHandlerWith(b *testing.B) {
+	ctx := logctx.Context(context.Background(), slog.NewJSONHandler(io.Discard, nil))
+	logger := slog.New(ctxhandler.NewHandler(nil)).With("with0", "foo", "with1", 42)
+	b.ReportAllocs()
+	for i := range b.N {
+		logger.InfoContext(ctx, "test line", "bench_i", i)
+	}
+}
+
+func BenchmarkDirectWith(b *testing.B) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil)).With("with0", "foo", "with1", 42)
+	b.ReportAllocs()
+	for i := range b.N {
+		logger.InfoContext(ctx, "test line", "bench_i", i)
+	}
+}
+
+func TestSugarContextAttrs(t *testing.T) {
+	th := logtest.NewTestHandler(t)
+	ctx := logctx.Context(context.Background(), th.H)
+
+	ctx = lgsg.Sugar{}.A("attr1", 10).Context(ctx)
+	ctx = l.A("attr2", 20).Context(ctx)
+	require.Equal(t, []slog.Attr{slog.Int("attr1", 10), slog.Int("attr2", 20)}, logctx.Attrs(ctx))
+
+	logctx.Info(ctx, "message")
+	th.RequireLine(slog.LevelInfo, "message", "attr1", 10, "attr2", 20)
+}
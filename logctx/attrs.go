@@ -0,0 +1,343 @@
+package logctx
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync/atomic"
+
+	"github.com/croepha/go-logging-extras/internal"
+)
+
+/*
+
+The handler in the context only keeps attributes in whatever form the handler
+preformats them, so the context also keeps an immutable list of the changes made
+to the handler.  This is used to read back attributes with Attrs or a Key, and to
+rebuild the handler when an attribute is replaced.
+
+The list is only used for reading back and rebuilding, attributes are emitted by the handler.
+
+*/
+
+// See contextKey for why this is a string
+var nodesContextKey any = "slog.Handler-nodes-7263656f68700a61"
+
+type nodeKind int
+
+const (
+	baseNode  nodeKind = iota // handler set with Context
+	attrsNode                 // attributes added with WithAttrs
+	wrapNode                  // handler wrapped by a function
+	groupNode                 // group opened with Group
+)
+
+// Immutable list of changes made to the handler, most recent first
+type ctxNode struct {
+	kind   nodeKind
+	parent *ctxNode
+
+	before slog.Handler // handler this change was applied to, unset for baseNode
+	after  slog.Handler // result of applying this change
+
+	attrs []slog.Attr
+	raws  []any // values as given, slog.Any converts some types, ie int to int64
+	wrap  func(h slog.Handler, parent *ctxNode) slog.Handler
+	group string
+
+	exported atomic.Pointer[exportedCtx] // see Registry.exportedValue
+}
+
+// Returns n and its parents, most recent first, up to the handler set with Context that
+// the current handler was built from.  Attributes from before that aren't emitted by it,
+// unless it was set to the handler it replaced, ie: Context(ctx, Handler(ctx))
+func (n *ctxNode) emitted() []*ctxNode {
+	var nodes []*ctxNode
+	for ; n != nil; n = n.parent {
+		if n.kind == baseNode && (n.parent == nil || !internal.SameHandler(n.after, n.parent.after)) {
+			break
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+// Returns true if a group was opened since the last Context call
+func (n *ctxNode) inGroup() bool {
+	for ; n != nil && n.kind != baseNode; n = n.parent {
+		if n.kind == groupNode {
+			return true
+		}
+	}
+	return false
+}
+
+// Copies the change, without the derived state
+func (n *ctxNode) clone() *ctxNode {
+	return &ctxNode{kind: n.kind, attrs: n.attrs, raws: n.raws, wrap: n.wrap, group: n.group}
+}
+
+func (n *ctxNode) apply(h slog.Handler) slog.Handler {
+	switch n.kind {
+	case attrsNode:
+		return h.WithAttrs(n.attrs)
+	case wrapNode:
+		return n.wrap(h, n.parent)
+	case groupNode:
+		return h.WithGroup(n.group)
+	default:
+		return n.after
+	}
+}
+
+// Context that holds both the handler and the node list, this also lets a context
+// that is repeatedly updated replace the previous one instead of nesting them
+type logCtx struct {
+	context.Context
+	reg  *Registry
+	node *ctxNode
+}
+
+func (c *logCtx) Value(key any) any {
+	switch key {
+	case c.reg.handlerKey:
+		return c.node.after
+	case c.reg.nodesKey:
+		return c.node
+	}
+	if v, ok := c.reg.exportedValue(c.node, key); ok {
+		return v
+	}
+	return c.Context.Value(key)
+}
+
+func (r *Registry) nodeList(ctx context.Context) *ctxNode {
+	n, _ := ctx.Value(r.nodesKey).(*ctxNode)
+	return n
+}
+
+func (r *Registry) withNode(ctx context.Context, n *ctxNode) context.Context {
+	if c, ok := ctx.(*logCtx); ok && c.reg.handlerKey == r.handlerKey {
+		ctx = c.Context // c only holds values that n replaces
+	}
+	return &logCtx{Context: ctx, reg: r, node: n}
+}
+
+// Adds node on top of the handler from the context
+func (r *Registry) pushNode(ctx context.Context, n *ctxNode) context.Context {
+	n.parent = r.nodeList(ctx)
+	n.before = r.Handler(ctx)
+	n.after = n.apply(n.before)
+	return r.withNode(ctx, n)
+}
+
+func (r *Registry) addAttrs(ctx context.Context, attrs []slog.Attr, raws []any, replace bool) context.Context {
+	if replace {
+		for i, a := range attrs {
+			if c, ok := r.replaceAttr(ctx, a, raws[i]); ok {
+				ctx = c
+			} else {
+				ctx = r.pushNode(ctx, &ctxNode{kind: attrsNode, attrs: []slog.Attr{a}, raws: []any{raws[i]}})
+			}
+		}
+	} else {
+		ctx = r.pushNode(ctx, &ctxNode{kind: attrsNode, attrs: attrs, raws: raws})
+	}
+	return r.withProfileLabels(ctx, attrs)
+}
+
+// Rebuilds the handler without the previous attribute with the same key, then adds attr
+// returns false if that isn't possible
+func (r *Registry) replaceAttr(ctx context.Context, attr slog.Attr, raw any) (context.Context, bool) {
+	top := r.nodeList(ctx)
+	if top == nil || !internal.SameHandler(top.after, r.Handler(ctx)) {
+		return ctx, false // Handler was changed without us
+	}
+
+	var newer []*ctxNode
+	old := top
+	for ; old != nil; old = old.parent {
+		if old.kind == baseNode {
+			return ctx, false // Unknown if the base handler already has attr
+		}
+		if old.kind == groupNode {
+			return ctx, false // Attributes outside of the current group don't conflict
+		}
+		if old.kind == attrsNode && slices.ContainsFunc(old.attrs, func(a slog.Attr) bool { return a.Key == attr.Key }) {
+			break
+		}
+		newer = append(newer, old)
+	}
+	if old == nil {
+		return ctx, false
+	}
+
+	// Replay the changes made after old onto the handler from before old
+	parent, h := old.parent, old.before
+	replay := func(n *ctxNode) {
+		n.parent, n.before = parent, h
+		n.after = n.apply(h)
+		parent, h = n, n.after
+	}
+
+	without := old.clone()
+	without.attrs, without.raws = nil, nil
+	for i, a := range old.attrs {
+		if a.Key != attr.Key {
+			without.attrs = append(without.attrs, a)
+			without.raws = append(without.raws, old.raws[i])
+		}
+	}
+	if len(without.attrs) > 0 {
+		replay(without)
+	}
+	for _, n := range slices.Backward(newer) {
+		replay(n.clone())
+	}
+	replay(&ctxNode{kind: attrsNode, attrs: []slog.Attr{attr}, raws: []any{raw}})
+
+	return r.withNode(ctx, parent), true
+}
+
+// Rebuilds the handler with attrs added before the first group opened with Group, so they are
+// at the root of records regardless of groups, attributes with the same keys there are removed.
+// Returns false if the handler was changed without us
+func (r *Registry) rootAttrs(ctx context.Context, attrs []slog.Attr, raws []any) (context.Context, bool) {
+	top := r.nodeList(ctx)
+	if top == nil || !internal.SameHandler(top.after, r.Handler(ctx)) {
+		return ctx, false
+	}
+
+	// Changes since the last Context call, oldest first
+	var nodes []*ctxNode
+	for n := top; n != nil && n.kind != baseNode; n = n.parent {
+		nodes = append(nodes, n)
+	}
+	slices.Reverse(nodes)
+
+	insert := slices.IndexFunc(nodes, func(n *ctxNode) bool { return n.kind == groupNode })
+	if insert < 0 {
+		insert = len(nodes)
+	}
+	replaced := func(a slog.Attr) bool {
+		return slices.ContainsFunc(attrs, func(b slog.Attr) bool { return a.Key == b.Key })
+	}
+	conflicts := func(n *ctxNode) bool {
+		return n.kind == attrsNode && slices.ContainsFunc(n.attrs, replaced)
+	}
+	from := slices.IndexFunc(nodes[:insert], conflicts)
+	if from < 0 {
+		from = insert
+	}
+
+	// Replay the changes from there onto the handler from before
+	parent, h := top, top.after
+	if from < len(nodes) {
+		parent, h = nodes[from].parent, nodes[from].before
+	}
+	replay := func(n *ctxNode) {
+		n.parent, n.before = parent, h
+		n.after = n.apply(h)
+		parent, h = n, n.after
+	}
+
+	for i := from; i <= len(nodes); i++ {
+		if i == insert {
+			replay(&ctxNode{kind: attrsNode, attrs: attrs, raws: raws})
+		}
+		if i == len(nodes) {
+			break
+		}
+		n := nodes[i].clone()
+		if i < insert && conflicts(n) {
+			n.attrs, n.raws = nil, nil
+			for j, a := range nodes[i].attrs {
+				if !replaced(a) {
+					n.attrs = append(n.attrs, a)
+					n.raws = append(n.raws, nodes[i].raws[j])
+				}
+			}
+			if len(n.attrs) == 0 {
+				continue
+			}
+		}
+		replay(n)
+	}
+
+	return r.withNode(ctx, parent), true
+}
+
+// Like the package level Attrs
+func (r *Registry) Attrs(ctx context.Context) []slog.Attr {
+	nodes := r.nodeList(ctx).emitted()
+
+	type group struct {
+		name  string
+		attrs []slog.Attr
+	}
+	groups := []group{{}}
+	for _, n := range slices.Backward(nodes) {
+		switch n.kind {
+		case groupNode:
+			groups = append(groups, group{name: n.group})
+		case attrsNode:
+			g := &groups[len(groups)-1]
+			g.attrs = append(g.attrs, n.attrs...)
+		}
+	}
+	for len(groups) > 1 {
+		g := groups[len(groups)-1]
+		groups = groups[:len(groups)-1]
+		if len(g.attrs) > 0 {
+			p := &groups[len(groups)-1]
+			p.attrs = append(p.attrs, slog.Attr{Key: g.name, Value: slog.GroupValue(g.attrs...)})
+		}
+	}
+	return groups[0].attrs
+}
+
+// Typed key for well known context attributes
+// Values set with a key are added like any other attribute, and can be read back with the right type
+type Key[T any] struct {
+	name string
+}
+
+// Creates a new key, name is used as the attribute name
+func NewKey[T any](name string) Key[T] {
+	return Key[T]{name: name}
+}
+
+// Returns the attribute name
+func (k Key[T]) Name() string {
+	return k.name
+}
+
+// Returns context with the value added as an attribute
+func (k Key[T]) Set(ctx context.Context, v T) context.Context {
+	return k.SetIn(ctx, defaultRegistry, v)
+}
+
+// Like Set, for the attributes of registry r
+func (k Key[T]) SetIn(ctx context.Context, r *Registry, v T) context.Context {
+	return r.Attr(ctx, k.name, v)
+}
+
+// Gets the most recently added value for this key, regardless of which group it was added in
+// returns false if there is no value or it has a different type
+func (k Key[T]) Get(ctx context.Context) (T, bool) {
+	return k.GetIn(ctx, defaultRegistry)
+}
+
+// Like Get, for the attributes of registry r
+func (k Key[T]) GetIn(ctx context.Context, r *Registry) (T, bool) {
+	for _, n := range r.nodeList(ctx).emitted() {
+		for i, a := range slices.Backward(n.attrs) {
+			if a.Key == k.name {
+				v, ok := n.raws[i].(T)
+				return v, ok
+			}
+		}
+	}
+	var zero T
+	return zero, false
+}
@@ -0,0 +1,196 @@
+package logctx_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"reflect"
+	"runtime/pprof"
+	"testing"
+
+	"github.com/croepha/go-logging-extras/logctx"
+	"github.com/croepha/go-logging-extras/logtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttrs(t *testing.T) {
+	th := logtest.NewTestHandler(t)
+	ctx := logctx.Context(context.Background(), th.H)
+
+	require.Empty(t, logctx.Attrs(ctx))
+
+	userID := logctx.NewKey[int]("user_id")
+
+	ctx = logctx.Attr(ctx, "attr0", "foo")
+	ctx = userID.Set(ctx, 42)
+	ctx = logctx.WithRequestID(ctx, "req-1")
+
+	require.Equal(t, []slog.Attr{
+		slog.String("attr0", "foo"),
+		slog.Int("user_id", 42),
+		slog.String("request_id", "req-1"),
+	}, logctx.Attrs(ctx))
+
+	id, ok := userID.Get(ctx)
+	require.True(t, ok)
+	require.Equal(t, 42, id)
+	require.Equal(t, "req-1", logctx.RequestID(ctx))
+
+	_, ok = logctx.NewKey[string]("user_id").Get(ctx)
+	require.False(t, ok)
+	_, ok = logctx.NewKey[string]("missing").Get(ctx)
+	require.False(t, ok)
+
+	logctx.Info(ctx, "attrs test")
+	th.RequireLine(slog.LevelInfo, "attrs test", "attr0", "foo", "user_id", 42, "request_id", "req-1")
+}
+
+// Only the attributes the handler emits are read back
+func TestAttrsNewHandler(t *testing.T) {
+	th := logtest.NewTestHandler(t)
+	ctx := logctx.Context(context.Background(), th.H)
+	ctx = logctx.WithRequestID(ctx, "req-1")
+
+	// Same handler, still emits request_id
+	same := logctx.Context(ctx, logctx.Handler(ctx))
+	require.Equal(t, []slog.Attr{slog.String("request_id", "req-1")}, logctx.Attrs(same))
+	require.Equal(t, "req-1", logctx.RequestID(same))
+
+	other := logtest.NewTestHandler(t)
+	ctx = logctx.Context(ctx, other.H)
+	require.Empty(t, logctx.Attrs(ctx))
+	require.Equal(t, "", logctx.RequestID(ctx))
+
+	ctx = logctx.Attr(ctx, "attr0", "foo")
+	require.Equal(t, []slog.Attr{slog.String("attr0", "foo")}, logctx.Attrs(ctx))
+	logctx.Info(ctx, "new handler test")
+	other.RequireLine(slog.LevelInfo, "new handler test", "attr0", "foo")
+	th.RequireEOF()
+}
+
+func TestReplaceAttr(t *testing.T) {
+	th := logtest.NewTestHandler(t)
+	ctx := logctx.Context(context.Background(), th.H)
+
+	ctx = logctx.Attr(ctx, "attr0", "foo")
+	ctx = logctx.ReplaceAttr(ctx, "step", 1)
+	ctx = logctx.WithLevel(ctx, slog.LevelDebug)
+	ctx = logctx.Attr(ctx, "attr1", "bar")
+	for step := range 10 {
+		ctx = logctx.ReplaceAttr(ctx, "step", step)
+	}
+
+	logctx.Debug(ctx, "replace test")
+	th.RequireLine(slog.LevelDebug, "replace test", "attr0", "foo", "attr1", "bar", "step", 9)
+	require.Equal(t, []slog.Attr{
+		slog.String("attr0", "foo"),
+		slog.String("attr1", "bar"),
+		slog.Int("step", 9),
+	}, logctx.Attrs(ctx))
+
+	// The handler was set after step was added, so it can't be removed from it
+	ctx = logctx.Context(ctx, logctx.Handler(ctx))
+	ctx = logctx.ReplaceAttr(ctx, "step", 10)
+	logctx.Debug(ctx, "replace test")
+	th.RequireLine(slog.LevelDebug, "replace test", "attr0", "foo", "attr1", "bar", "step", 9, "step", 10)
+
+	logctx.SetReplaceSameKey(true)
+	defer logctx.SetReplaceSameKey(false)
+	ctx = logctx.Attr(ctx, "step", 11)
+	logctx.Debug(ctx, "replace test")
+	th.RequireLine(slog.LevelDebug, "replace test", "attr0", "foo", "attr1", "bar", "step", 9, "step", 11)
+}
+
+// Number of times a long lived context is updated per op
+const longLivedSteps = 1000
+
+// A value handler that can't be compared
+type sliceHandler struct {
+	slog.Handler
+	tags []string
+}
+
+// Comparable type, but holds an uncomparable handler
+type valueHandler struct {
+	slog.Handler
+}
+
+func TestReplaceAttrUncomparable(t *testing.T) {
+	th := logtest.NewTestHandler(t)
+	ctx := logctx.Context(context.Background(), valueHandler{sliceHandler{Handler: th.H}})
+
+	ctx = logctx.ReplaceAttr(ctx, "step", 1)
+	ctx = logctx.ReplaceAttr(ctx, "step", 2)
+	require.Equal(t, []slog.Attr{slog.Int("step", 2)}, logctx.Attrs(ctx))
+	logctx.Info(ctx, "uncomparable test")
+	th.RequireLine(slog.LevelInfo, "uncomparable test", "step", 2)
+
+	logctx.SetReplaceSameKey(true)
+	defer logctx.SetReplaceSameKey(false)
+	ctx = logctx.Attr(ctx, "step", 3)
+	require.Equal(t, []slog.Attr{slog.Int("step", 3)}, logctx.Attrs(ctx))
+
+	_, end := logctx.Start(ctx, "span")
+	end(nil)
+}
+
+// Compare with BenchmarkReplaceAttr, the context keeps growing
+// each op builds a new context, growth is quadratic so b.N steps would run out of memory
+func BenchmarkAttrLongLived(b *testing.B) {
+	base := logctx.Context(context.Background(), slog.NewJSONHandler(io.Discard, nil))
+	base = logctx.Attr(base, "attr0", "foo")
+	ctx := base
+	for range b.N {
+		ctx = base
+		for i := range longLivedSteps {
+			ctx = logctx.Attr(ctx, "step", i)
+		}
+	}
+	b.ReportMetric(float64(len(logctx.Attrs(ctx))), "attrs")
+}
+
+// Number of nested contexts
+func contextDepth(ctx context.Context) int {
+	n := 0
+	for v := reflect.ValueOf(ctx); ; n++ {
+		for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			return n
+		}
+		if v = v.FieldByName("Context"); !v.IsValid() {
+			return n
+		}
+	}
+}
+
+func TestReplaceAttrBounded(t *testing.T) {
+	r := logctx.NewRegistry("bounded")
+	r.SetProfileLabels("step", "attr0")
+	ctx := r.Context(context.Background(), slog.NewJSONHandler(io.Discard, nil))
+	ctx = r.Attr(ctx, "attr0", "foo")
+	depth := contextDepth(ctx)
+	for i := range 1000 {
+		ctx = r.ReplaceAttr(ctx, "step", i)
+	}
+	require.LessOrEqual(t, contextDepth(ctx), depth+1)
+
+	step, _ := pprof.Label(ctx, "step")
+	require.Equal(t, "999", step)
+	attr0, _ := pprof.Label(ctx, "attr0")
+	require.Equal(t, "foo", attr0)
+}
+
+func BenchmarkReplaceAttr(b *testing.B) {
+	base := logctx.Context(context.Background(), slog.NewJSONHandler(io.Discard, nil))
+	base = logctx.Attr(base, "attr0", "foo")
+	ctx := base
+	for range b.N {
+		ctx = base
+		for i := range longLivedSteps {
+			ctx = logctx.ReplaceAttr(ctx, "step", i)
+		}
+	}
+	b.ReportMetric(float64(len(logctx.Attrs(ctx))), "attrs")
+}
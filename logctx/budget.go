@@ -0,0 +1,117 @@
+package logctx
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+
+	"github.com/croepha/go-logging-extras/logwrap"
+)
+
+// Returns context that allows at most maxRecords records and maxBytes bytes to be logged with it
+// and any context derived from it, 0 means no limit.  Bytes are approximated from the message
+// and the record's attributes.  When the budget runs out, one warning is logged and further
+// records are suppressed.  end logs a summary of the suppressed records per level, if there were any.
+func WithBudget(ctx context.Context, maxRecords, maxBytes int) (_ context.Context, end func()) {
+	return defaultRegistry.WithBudget(ctx, maxRecords, maxBytes)
+}
+
+// Like the package level WithBudget
+func (r *Registry) WithBudget(ctx context.Context, maxRecords, maxBytes int) (_ context.Context, end func()) {
+	b := &budget{maxRecords: maxRecords, maxBytes: maxBytes, suppressed: map[slog.Level]int{}}
+	parent := ctx
+	ctx = r.pushNode(ctx, &ctxNode{kind: wrapNode, wrap: func(h slog.Handler, _ *ctxNode) slog.Handler {
+		return &budgetHandler{next: h, budget: b}
+	}})
+	return ctx, func() {
+		b.mu.Lock()
+		levels := make([]slog.Level, 0, len(b.suppressed))
+		for l := range b.suppressed {
+			levels = append(levels, l)
+		}
+		slices.Sort(levels)
+		var counts []any
+		for _, l := range levels {
+			counts = append(counts, slog.Int(l.String(), b.suppressed[l]))
+		}
+		b.mu.Unlock()
+
+		if len(counts) > 0 {
+			logwrap.LogAttrs(parent, r.Handler(parent), 1, slog.LevelWarn,
+				[]slog.Attr{slog.Group("suppressed", counts...)}, "log budget summary")
+		}
+	}
+}
+
+// Shared by all handlers derived from the same WithBudget call
+type budget struct {
+	maxRecords, maxBytes int
+
+	mu         sync.Mutex
+	records    int
+	bytes      int
+	exhausted  bool
+	suppressed map[slog.Level]int
+}
+
+func recordSize(r slog.Record) int {
+	n := len(r.Message)
+	r.Attrs(func(a slog.Attr) bool {
+		n += len(a.Key) + len(a.Value.String())
+		return true
+	})
+	return n
+}
+
+// Returns if the record is allowed, and if the budget just ran out
+func (b *budget) take(r slog.Record) (allowed, exhausted bool) {
+	size := 0
+	if b.maxBytes > 0 {
+		size = recordSize(r)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.exhausted &&
+		(b.maxRecords <= 0 || b.records < b.maxRecords) &&
+		(b.maxBytes <= 0 || b.bytes+size <= b.maxBytes) {
+		b.records++
+		b.bytes += size
+		return true, false
+	}
+	b.suppressed[r.Level]++
+	exhausted = !b.exhausted
+	b.exhausted = true
+	return false, exhausted
+}
+
+type budgetHandler struct {
+	next   slog.Handler
+	budget *budget
+}
+
+func (h *budgetHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	return h.next.Enabled(ctx, l)
+}
+
+func (h *budgetHandler) Handle(ctx context.Context, r slog.Record) error {
+	allowed, exhausted := h.budget.take(r)
+	if allowed {
+		return h.next.Handle(ctx, r)
+	}
+	if exhausted {
+		w := slog.NewRecord(r.Time, slog.LevelWarn, "log budget exhausted, suppressing further records", r.PC)
+		w.AddAttrs(slog.Int("max_records", h.budget.maxRecords), slog.Int("max_bytes", h.budget.maxBytes))
+		return h.next.Handle(ctx, w)
+	}
+	return nil
+}
+
+func (h *budgetHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &budgetHandler{next: h.next.WithAttrs(attrs), budget: h.budget}
+}
+
+func (h *budgetHandler) WithGroup(name string) slog.Handler {
+	return &budgetHandler{next: h.next.WithGroup(name), budget: h.budget}
+}
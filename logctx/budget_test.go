@@ -0,0 +1,42 @@
+package logctx_test
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/croepha/go-logging-extras/logctx"
+	"github.com/croepha/go-logging-extras/logtest"
+)
+
+func TestWithBudget(t *testing.T) {
+	th := logtest.NewTestHandler(t)
+	ctx := logctx.Context(context.Background(), th.H)
+
+	ctx, end := logctx.WithBudget(ctx, 2, 0)
+	ctx = logctx.Attr(ctx, "attr0", "foo")
+
+	logctx.Info(ctx, "info 1")
+	th.RequireLine(slog.LevelInfo, "info 1", "attr0", "foo")
+	logctx.Info(ctx, "info 2")
+	th.RequireLine(slog.LevelInfo, "info 2", "attr0", "foo")
+
+	logctx.Info(ctx, "info 3")
+	th.RequireLine(slog.LevelWarn, "log budget exhausted, suppressing further records", "attr0", "foo", "max_records", 2, "max_bytes", 0)
+	logctx.Error(ctx, "error")
+	logctx.Info(ctx, "info 4")
+	th.RequireEOF()
+
+	end()
+	th.RequireLineExtra(-1, 0, slog.LevelWarn, "log budget summary", "suppressed", map[string]any{"INFO": 2, "ERROR": 1})
+	th.RequireEOF()
+
+	ctx, end = logctx.WithBudget(logctx.Context(context.Background(), th.H), 0, 10)
+	logctx.Info(ctx, "0123456789")
+	th.RequireLine(slog.LevelInfo, "0123456789")
+	logctx.Info(ctx, "x")
+	th.RequireLine(slog.LevelWarn, "log budget exhausted, suppressing further records", "max_records", 0, "max_bytes", 10)
+	end()
+	th.RequireLineExtra(-1, 0, slog.LevelWarn, "log budget summary", "suppressed", map[string]any{"INFO": 1})
+	th.RequireEOF()
+}
@@ -0,0 +1,117 @@
+package logctx
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+)
+
+// Options for Buffered, the zero value is valid
+type BufferOptions struct {
+	// Records at or above this level that the handler doesn't enable are buffered, defaults to Debug
+	Level slog.Leveler
+
+	// Records at or above this level flush the buffer, defaults to Error
+	FlushLevel slog.Leveler
+
+	// Max number of buffered records, the oldest are discarded first, defaults to 1000
+	Size int
+}
+
+// Returns context that keeps records below the handler's level in a bounded buffer instead of
+// dropping them.  When a record at or above FlushLevel is logged with the context (or one derived
+// from it) the buffered records are logged first, in order and with their original time and source.
+// If that never happens, the buffered records are discarded along with the context.
+// opts may be nil
+func Buffered(ctx context.Context, opts *BufferOptions) context.Context {
+	return defaultRegistry.Buffered(ctx, opts)
+}
+
+// Like the package level Buffered
+func (r *Registry) Buffered(ctx context.Context, opts *BufferOptions) context.Context {
+	b := &recordBuffer{level: slog.LevelDebug, flushLevel: slog.LevelError, size: 1000}
+	if opts != nil {
+		if opts.Level != nil {
+			b.level = opts.Level
+		}
+		if opts.FlushLevel != nil {
+			b.flushLevel = opts.FlushLevel
+		}
+		if opts.Size > 0 {
+			b.size = opts.Size
+		}
+	}
+	return r.pushNode(ctx, &ctxNode{kind: wrapNode, wrap: func(h slog.Handler, _ *ctxNode) slog.Handler {
+		return &bufferHandler{next: h, buf: b}
+	}})
+}
+
+// Shared by all handlers derived from the same Buffered call
+type recordBuffer struct {
+	level      slog.Leveler
+	flushLevel slog.Leveler
+	size       int
+
+	mu      sync.Mutex
+	records []bufferedRecord // ring, start is the oldest
+	start   int
+}
+
+type bufferedRecord struct {
+	ctx     context.Context
+	handler slog.Handler
+	record  slog.Record
+}
+
+func (b *recordBuffer) add(br bufferedRecord) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.records) < b.size {
+		b.records = append(b.records, br)
+		return
+	}
+	b.records[b.start] = br
+	b.start = (b.start + 1) % b.size
+}
+
+func (b *recordBuffer) take() []bufferedRecord {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	r := slices.Concat(b.records[b.start:], b.records[:b.start])
+	b.records, b.start = nil, 0
+	return r
+}
+
+type bufferHandler struct {
+	next slog.Handler
+	buf  *recordBuffer
+}
+
+func (h *bufferHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	return l >= h.buf.level.Level() || h.next.Enabled(ctx, l)
+}
+
+func (h *bufferHandler) Handle(ctx context.Context, r slog.Record) error {
+	if !h.next.Enabled(ctx, r.Level) {
+		h.buf.add(bufferedRecord{ctx: ctx, handler: h.next, record: r.Clone()})
+		return nil
+	}
+	var errs []error
+	if r.Level >= h.buf.flushLevel.Level() {
+		for _, br := range h.buf.take() {
+			errs = append(errs, br.handler.Handle(br.ctx, br.record))
+		}
+	}
+	errs = append(errs, h.next.Handle(ctx, r))
+	return errors.Join(errs...)
+}
+
+func (h *bufferHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &bufferHandler{next: h.next.WithAttrs(attrs), buf: h.buf}
+}
+
+func (h *bufferHandler) WithGroup(name string) slog.Handler {
+	return &bufferHandler{next: h.next.WithGroup(name), buf: h.buf}
+}
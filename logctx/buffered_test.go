@@ -0,0 +1,35 @@
+package logctx_test
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/croepha/go-logging-extras/logctx"
+	"github.com/croepha/go-logging-extras/logtest"
+)
+
+func TestBuffered(t *testing.T) {
+	th := logtest.NewTestHandler(t)
+	ctx := logctx.Context(context.Background(), th.H)
+	ctx = logctx.Buffered(ctx, &logctx.BufferOptions{Size: 2})
+
+	logctx.Debug(ctx, "dropped")
+	logctx.Debug(logctx.Attr(ctx, "attr0", "foo"), "debug 1")
+	th.RequireEOF()
+
+	logctx.Info(ctx, "info")
+	th.RequireLine(slog.LevelInfo, "info")
+
+	logctx.Debug(ctx, "debug 2")
+	th.RequireEOF()
+
+	logctx.Error(ctx, "error")
+	th.RequireLineExtra(-10, 0, slog.LevelDebug, "debug 1", "attr0", "foo")
+	th.RequireLineExtra(-5, 0, slog.LevelDebug, "debug 2")
+	th.RequireLineExtra(-3, 0, slog.LevelError, "error")
+	th.RequireEOF()
+
+	logctx.Error(ctx, "error")
+	th.RequireLine(slog.LevelError, "error")
+}
@@ -0,0 +1,87 @@
+package logctx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+)
+
+// Collects records logged with a context returned by Capture, as JSON lines
+type Captured struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (c *Captured) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buf.Write(p)
+}
+
+// Returns a copy of the captured records, one JSON object per line
+func (c *Captured) Bytes() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return bytes.Clone(c.buf.Bytes())
+}
+
+// Returns the captured records, one JSON object per line
+func (c *Captured) String() string {
+	return string(c.Bytes())
+}
+
+// Returns context where records at or above level are also written to the returned Captured,
+// records are still logged with the context's handler as usual.  Useful for returning the
+// logs of a request in a debug response.
+func Capture(ctx context.Context, level slog.Leveler) (context.Context, *Captured) {
+	return defaultRegistry.Capture(ctx, level)
+}
+
+// Like the package level Capture
+func (r *Registry) Capture(ctx context.Context, level slog.Leveler) (context.Context, *Captured) {
+	c := &Captured{}
+	base := slog.NewJSONHandler(c, &slog.HandlerOptions{Level: level, AddSource: true})
+
+	return r.pushNode(ctx, &ctxNode{kind: wrapNode, wrap: func(h slog.Handler, parent *ctxNode) slog.Handler {
+		// Apply the attributes and groups the context's handler has
+		var ch slog.Handler = base
+		for _, n := range slices.Backward(parent.emitted()) {
+			switch n.kind {
+			case attrsNode, groupNode:
+				ch = n.apply(ch)
+			}
+		}
+		return &teeHandler{next: h, capture: ch}
+	}}), c
+}
+
+type teeHandler struct {
+	next    slog.Handler
+	capture slog.Handler
+}
+
+func (h *teeHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	return h.next.Enabled(ctx, l) || h.capture.Enabled(ctx, l)
+}
+
+func (h *teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	if h.next.Enabled(ctx, r.Level) {
+		errs = append(errs, h.next.Handle(ctx, r.Clone()))
+	}
+	if h.capture.Enabled(ctx, r.Level) {
+		errs = append(errs, h.capture.Handle(ctx, r))
+	}
+	return errors.Join(errs...)
+}
+
+func (h *teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &teeHandler{next: h.next.WithAttrs(attrs), capture: h.capture.WithAttrs(attrs)}
+}
+
+func (h *teeHandler) WithGroup(name string) slog.Handler {
+	return &teeHandler{next: h.next.WithGroup(name), capture: h.capture.WithGroup(name)}
+}
@@ -0,0 +1,55 @@
+package logctx_test
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/croepha/go-logging-extras/ctxhandler"
+	"github.com/croepha/go-logging-extras/logctx"
+	"github.com/croepha/go-logging-extras/logtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCapture(t *testing.T) {
+	th := logtest.NewTestHandler(t)
+	ctx := logctx.Context(context.Background(), th.H)
+	ctx = logctx.ReplaceAttr(ctx, "step", 1)
+
+	ctx, captured := logctx.Capture(ctx, slog.LevelDebug)
+	ctx = logctx.ReplaceAttr(ctx, "step", 2)
+
+	logctx.Debug(ctx, "debug")
+	th.RequireEOF()
+
+	slog.New(ctxhandler.NewHandler(nil)).InfoContext(ctx, "info")
+	th.RequireLine(slog.LevelInfo, "info", "step", 2)
+
+	lines := logtest.JSONLines(t, strings.NewReader(captured.String()))
+	require.Len(t, lines, 2)
+	require.Equal(t, "debug", lines[0]["msg"])
+	require.Equal(t, float64(2), lines[0]["step"])
+	require.Equal(t, "info", lines[1]["msg"])
+	require.Contains(t, lines[1], "source")
+	require.Equal(t, len(lines), strings.Count(captured.String(), `"step"`)) // Replaced, not duplicated
+}
+
+// Only the attributes the context's handler has are captured
+func TestCaptureNewHandler(t *testing.T) {
+	ctx := logctx.Context(context.Background(), logtest.NewTestHandler(t).H)
+	ctx = logctx.Attr(ctx, "old", 1)
+
+	th := logtest.NewTestHandler(t)
+	ctx = logctx.Context(ctx, th.H)
+	ctx = logctx.Attr(ctx, "new", 2)
+	ctx, captured := logctx.Capture(ctx, slog.LevelInfo)
+
+	logctx.Info(ctx, "info")
+	th.RequireLine(slog.LevelInfo, "info", "new", 2)
+
+	lines := logtest.JSONLines(t, strings.NewReader(captured.String()))
+	require.Len(t, lines, 1)
+	require.Equal(t, float64(2), lines[0]["new"])
+	require.NotContains(t, lines[0], "old")
+}
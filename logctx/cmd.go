@@ -0,0 +1,172 @@
+package logctx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options for Cmd, the zero value is valid
+type CmdOptions struct {
+	// Level of stdout lines, defaults to Info
+	StdoutLevel slog.Leveler
+
+	// Level of stderr lines, defaults to Warn
+	StderrLevel slog.Leveler
+
+	// If set, lines that are JSON objects are logged with their level, time and message,
+	// and their attributes are merged into the record, except those the context already has.
+	// For children that log with this module configured for JSON output, see loginit.ChildEnv
+	ParseJSON bool
+}
+
+// Sets cmd's Stdout and Stderr so each line is logged as a record with the context's
+// attributes plus stream and pid, the source is where Cmd was called.  Must be called
+// before cmd is started, flush must be called after cmd.Wait to log a final line
+// that doesn't end with a newline.  opts may be nil
+func Cmd(ctx context.Context, cmd *exec.Cmd, opts *CmdOptions) (flush func()) {
+	var o CmdOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.StdoutLevel == nil {
+		o.StdoutLevel = slog.LevelInfo
+	}
+	if o.StderrLevel == nil {
+		o.StderrLevel = slog.LevelWarn
+	}
+
+	var pcs [1]uintptr
+	runtime.Callers(2, pcs[:])
+
+	newWriter := func(stream string, level slog.Leveler) *lineWriter {
+		return &lineWriter{emit: func(line string) {
+			pid := 0
+			if cmd.Process != nil {
+				pid = cmd.Process.Pid
+			}
+			logLine(ctx, line, level.Level(), pcs[0], o.ParseJSON,
+				slog.String("stream", stream), slog.Int("pid", pid))
+		}}
+	}
+	stdout, stderr := newWriter("stdout", o.StdoutLevel), newWriter("stderr", o.StderrLevel)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	return func() {
+		_ = stdout.Close()
+		_ = stderr.Close()
+	}
+}
+
+func logLine(ctx context.Context, line string, level slog.Level, pc uintptr, parseJSON bool, attrs ...slog.Attr) {
+	h := Handler(ctx)
+	t, msg := time.Now(), line
+
+	var child map[string]any
+	if parseJSON && strings.HasPrefix(line, "{") {
+		dec := json.NewDecoder(strings.NewReader(line))
+		dec.UseNumber()
+		if dec.Decode(&child) != nil {
+			child = nil
+		}
+	}
+	if child != nil {
+		if s, ok := child[slog.LevelKey].(string); ok && level.UnmarshalText([]byte(s)) == nil {
+			delete(child, slog.LevelKey)
+		}
+		if s, ok := child[slog.TimeKey].(string); ok {
+			if ct, err := time.Parse(time.RFC3339Nano, s); err == nil {
+				t = ct
+				delete(child, slog.TimeKey)
+			}
+		}
+		if s, ok := child[slog.MessageKey].(string); ok {
+			msg = s
+			delete(child, slog.MessageKey)
+		}
+		if s, ok := child[slog.SourceKey]; ok {
+			child["child_source"] = s // Our own source is added by the handler
+			delete(child, slog.SourceKey)
+		}
+		for _, a := range Attrs(ctx) {
+			delete(child, a.Key) // ie: request_id passed with loginit.ChildEnv and logged back
+		}
+		attrs = append(attrs, jsonAttrs(child)...)
+	}
+
+	if !h.Enabled(ctx, level) {
+		return
+	}
+	r := slog.NewRecord(t, level, msg, pc)
+	r.AddAttrs(attrs...)
+	_ = h.Handle(ctx, r)
+}
+
+// Nested objects become groups
+func jsonAttrs(m map[string]any) []slog.Attr {
+	attrs := make([]slog.Attr, 0, len(m))
+	for _, k := range slices.Sorted(maps.Keys(m)) {
+		switch v := m[k].(type) {
+		case map[string]any:
+			attrs = append(attrs, slog.Attr{Key: k, Value: slog.GroupValue(jsonAttrs(v)...)})
+		case json.Number:
+			if i, err := v.Int64(); err == nil {
+				attrs = append(attrs, slog.Int64(k, i))
+			} else {
+				f, _ := v.Float64()
+				attrs = append(attrs, slog.Float64(k, f))
+			}
+		default:
+			attrs = append(attrs, slog.Any(k, v))
+		}
+	}
+	return attrs
+}
+
+// Longer lines are split
+const maxLineLength = 64 << 10
+
+// Calls emit for each line written, without the line ending
+type lineWriter struct {
+	mu   sync.Mutex
+	buf  []byte
+	emit func(line string)
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(string(bytes.TrimSuffix(w.buf[:i], []byte("\r"))))
+		w.buf = w.buf[i+1:]
+	}
+	for len(w.buf) >= maxLineLength {
+		w.emit(string(w.buf[:maxLineLength]))
+		w.buf = w.buf[maxLineLength:]
+	}
+	w.buf = slices.Clone(w.buf) // Don't keep the consumed lines alive
+	return len(p), nil
+}
+
+// Emits the final line if it didn't end with a newline
+func (w *lineWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) > 0 {
+		w.emit(string(w.buf))
+		w.buf = nil
+	}
+	return nil
+}
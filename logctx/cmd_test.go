@@ -0,0 +1,57 @@
+package logctx_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/croepha/go-logging-extras/logctx"
+	"github.com/croepha/go-logging-extras/logtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCmd(t *testing.T) {
+	th := logtest.NewTestHandler(t)
+	ctx := logctx.Attr(logctx.Context(context.Background(), th.H), "attr0", "foo")
+
+	cmd := exec.Command("sh", "-c", `echo line1; echo '{"level":"ERROR","msg":"child","attr1":1,"g":{"attr2":"bar"}}'; printf last`)
+	flush := logctx.Cmd(ctx, cmd, &logctx.CmdOptions{ParseJSON: true})
+	require.NoError(t, cmd.Run())
+	flush()
+	pid := cmd.Process.Pid
+
+	th.RequireLineExtra(-5, 0, slog.LevelInfo, "line1", "attr0", "foo", "stream", "stdout", "pid", pid)
+	th.RequireLineExtra(-6, 0, slog.LevelError, "child", "attr0", "foo", "stream", "stdout", "pid", pid,
+		"attr1", 1, "g", map[string]any{"attr2": "bar"})
+	th.RequireLineExtra(-8, 0, slog.LevelInfo, "last", "attr0", "foo", "stream", "stdout", "pid", pid)
+	th.RequireEOF()
+
+	cmd = exec.Command("sh", "-c", `echo '{"msg":"not parsed"}' >&2`)
+	flush = logctx.Cmd(ctx, cmd, nil)
+	require.NoError(t, cmd.Run())
+	flush()
+	th.RequireLineExtra(-3, 0, slog.LevelWarn, `{"msg":"not parsed"}`, "attr0", "foo", "stream", "stderr", "pid", cmd.Process.Pid)
+	th.RequireEOF()
+}
+
+// Like a child started with loginit.ChildEnv, that logs the request ID back
+func TestCmdChildAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := logctx.Context(context.Background(), slog.NewJSONHandler(&buf, nil))
+	ctx = logctx.WithRequestID(ctx, "req-1")
+
+	cmd := exec.Command("sh", "-c", `echo '{"msg":"child","request_id":"req-1","attr1":1}'`)
+	flush := logctx.Cmd(ctx, cmd, &logctx.CmdOptions{ParseJSON: true})
+	require.NoError(t, cmd.Run())
+	flush()
+
+	require.Equal(t, 1, strings.Count(buf.String(), `"request_id":`), buf.String())
+	lines := logtest.JSONLines(t, &buf)
+	require.Len(t, lines, 1)
+	require.Equal(t, "child", lines[0]["msg"])
+	require.Equal(t, "req-1", lines[0]["request_id"])
+	require.Equal(t, float64(1), lines[0]["attr1"])
+}
@@ -0,0 +1,214 @@
+package logctx
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+
+Records logged before the program configured logging, ie: from package init functions or
+while parsing flags, are kept by an EarlyHandler.  The default registry uses one until the
+first call to SetDefaultHandler, which replays the records into the new handler.  Handlers
+derived from it, ie: by logctx.Attr before the first call, follow later SetDefaultHandler calls.
+
+*/
+
+// Buffers records until Replay is called, then forwards to the replay handler
+type EarlyHandler struct {
+	state   *earlyState
+	ops     []handlerOp
+	derived atomic.Pointer[earlyDerived] // target with ops applied, once replayed or dumped
+}
+
+type earlyDerived struct {
+	from    *slog.Handler // state.target this was derived from
+	handler slog.Handler
+}
+
+type earlyState struct {
+	size      int
+	dumpAfter time.Duration
+	target    atomic.Pointer[slog.Handler] // Only set with mu held
+	replayed  atomic.Bool                  // Only set with mu held
+
+	mu      sync.Mutex
+	records []earlyRecord // ring, start is the oldest
+	start   int
+	dropped int
+	timer   *time.Timer
+}
+
+type earlyRecord struct {
+	ctx    context.Context
+	ops    []handlerOp
+	record slog.Record
+}
+
+// Creates a handler that keeps at most size records, discarding the oldest first
+// If Replay hasn't been called dumpAfter after the first record, the records are written to stderr,
+// and so are later records until Replay is called
+func NewEarlyHandler(size int, dumpAfter time.Duration) *EarlyHandler {
+	return &EarlyHandler{state: &earlyState{size: size, dumpAfter: dumpAfter}}
+}
+
+// Not replayed or dumped yet
+func (h *EarlyHandler) pending() bool {
+	return h.state.target.Load() == nil
+}
+
+func (h *EarlyHandler) replayed() bool {
+	return h.state.replayed.Load()
+}
+
+// Returns the replay handler with ops applied, or nil if not replayed or dumped yet
+func (h *EarlyHandler) forward() slog.Handler {
+	t := h.state.target.Load()
+	if t == nil {
+		return nil
+	}
+	if d := h.derived.Load(); d != nil && d.from == t {
+		return d.handler
+	}
+	d := &earlyDerived{from: t, handler: applyOps(*t, h.ops)}
+	h.derived.Store(d)
+	return d.handler
+}
+
+// Logs the buffered records with to, in order and with their original time and source,
+// records logged afterwards are passed to to directly.  Returns false if already replayed.
+func (h *EarlyHandler) Replay(to slog.Handler) bool {
+	return h.replay(to, false)
+}
+
+// Like Replay, but if already replayed, records are passed to to from now on instead
+func (h *EarlyHandler) redirect(to slog.Handler) {
+	h.replay(to, true)
+}
+
+func (h *EarlyHandler) replay(to slog.Handler, redirect bool) bool {
+	s := h.state
+	s.mu.Lock()
+	if s.replayed.Load() {
+		if redirect {
+			s.target.Store(&to)
+		}
+		s.mu.Unlock()
+		return false
+	}
+	s.replayed.Store(true)
+	s.target.Store(&to)
+	records, dropped := s.take()
+	s.mu.Unlock()
+
+	writeEarly(to, records, dropped)
+	return true
+}
+
+// Takes the buffered records, mu must be held
+func (s *earlyState) take() ([]earlyRecord, int) {
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	records := slices.Concat(s.records[s.start:], s.records[:s.start])
+	dropped := s.dropped
+	s.records, s.start, s.dropped = nil, 0, 0
+	return records, dropped
+}
+
+func writeEarly(to slog.Handler, records []earlyRecord, dropped int) {
+	if dropped > 0 {
+		r := slog.NewRecord(time.Now(), slog.LevelWarn, "early log buffer full, oldest records were dropped", 0)
+		r.AddAttrs(slog.Int("dropped", dropped))
+		_ = to.Handle(context.Background(), r)
+	}
+	for _, er := range records {
+		th := applyOps(to, er.ops)
+		if th.Enabled(er.ctx, er.record.Level) {
+			_ = th.Handle(er.ctx, er.record)
+		}
+	}
+}
+
+// Writes the buffered records to stderr, later records also go there until Replay is called
+func (h *EarlyHandler) dump() {
+	s := h.state
+	s.mu.Lock()
+	if s.target.Load() != nil {
+		s.mu.Unlock()
+		return
+	}
+	var to slog.Handler = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{AddSource: true, Level: slog.Level(math.MinInt)})
+	s.target.Store(&to)
+	records, dropped := s.take()
+	s.mu.Unlock()
+
+	writeEarly(to, records, dropped)
+}
+
+func (h *EarlyHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	if f := h.forward(); f != nil {
+		return f.Enabled(ctx, l)
+	}
+	return true // Not known yet what Replay's handler will enable
+}
+
+func (h *EarlyHandler) Handle(ctx context.Context, r slog.Record) error {
+	if f := h.forward(); f != nil {
+		return f.Handle(ctx, r)
+	}
+
+	s := h.state
+	s.mu.Lock()
+	if s.target.Load() != nil {
+		s.mu.Unlock() // Replayed or dumped meanwhile
+		return h.forward().Handle(ctx, r)
+	}
+	defer s.mu.Unlock()
+
+	er := earlyRecord{ctx: ctx, ops: h.ops, record: r.Clone()}
+	if len(s.records) < s.size {
+		s.records = append(s.records, er)
+	} else if s.size > 0 {
+		s.records[s.start] = er
+		s.start = (s.start + 1) % s.size
+		s.dropped++
+	} else {
+		s.dropped++
+	}
+	if s.timer == nil && s.dumpAfter > 0 {
+		s.timer = time.AfterFunc(s.dumpAfter, h.dump)
+	}
+	return nil
+}
+
+func (h *EarlyHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &EarlyHandler{state: h.state, ops: slices.Concat(h.ops, []handlerOp{{attrs: slices.Clone(attrs)}})}
+}
+
+func (h *EarlyHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &EarlyHandler{state: h.state, ops: slices.Concat(h.ops, []handlerOp{{group: name}})}
+}
+
+func applyOps(h slog.Handler, ops []handlerOp) slog.Handler {
+	for _, o := range ops {
+		if o.group != "" {
+			h = h.WithGroup(o.group)
+		} else {
+			h = h.WithAttrs(o.attrs)
+		}
+	}
+	return h
+}
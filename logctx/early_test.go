@@ -0,0 +1,108 @@
+package logctx_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/croepha/go-logging-extras/logctx"
+	"github.com/croepha/go-logging-extras/logtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEarlyHandler(t *testing.T) {
+	ctx := context.Background()
+	r := logctx.NewRegistry("early")
+	r.SetEarlyHandler(logctx.NewEarlyHandler(3, time.Hour))
+
+	r.Info(r.Group(r.Attr(ctx, "attr0", "foo"), "g"), "early info", "attr1", "bar")
+	r.Debug(ctx, "filtered by the replay handler")
+	r.Warn(ctx, "early warn")
+
+	th := logtest.NewTestHandler(t)
+	r.SetDefaultHandler(th.H)
+	th.RequireLineExtra(-6, 0, slog.LevelInfo, "early info", "attr0", "foo", "g", map[string]any{"attr1": "bar"})
+	th.RequireLineExtra(-5, 0, slog.LevelWarn, "early warn")
+	th.RequireEOF()
+
+	r.Info(ctx, "after")
+	th.RequireLine(slog.LevelInfo, "after")
+}
+
+func TestEarlyHandlerDropped(t *testing.T) {
+	var buf bytes.Buffer
+	h := logctx.NewEarlyHandler(1, time.Hour)
+	l := slog.New(h)
+	l.Info("first")
+	l.Info("second")
+	require.True(t, h.Replay(slog.NewTextHandler(&buf, &slog.HandlerOptions{ReplaceAttr: dropTime})))
+	require.Equal(t, "level=WARN msg=\"early log buffer full, oldest records were dropped\" dropped=1\nlevel=INFO msg=second\n", buf.String())
+	require.False(t, h.Replay(slog.NewTextHandler(&buf, nil)))
+
+	// Loggers created from the early handler are forwarded to the replay handler
+	buf.Reset()
+	wl := l.With("attr0", "foo")
+	wl.Info("third")
+	require.Equal(t, "level=INFO msg=third attr0=foo\n", buf.String())
+
+	// The derived replay handler is cached
+	require.Zero(t, testing.AllocsPerRun(100, func() {
+		wl.Handler().Enabled(context.Background(), slog.LevelInfo)
+	}))
+}
+
+func TestEarlyHandlerDump(t *testing.T) {
+	prevStderr := os.Stderr
+	pr, pw, err := os.Pipe()
+	require.NoError(t, err)
+	os.Stderr = pw
+	defer func() { os.Stderr = prevStderr }()
+
+	r := logctx.NewRegistry("early-dump")
+	r.SetEarlyHandler(logctx.NewEarlyHandler(10, time.Millisecond))
+	ctx := r.Attr(context.Background(), "attr0", "foo") // Derived from the early handler
+	r.Info(ctx, "never configured")
+
+	require.Eventually(t, func() bool {
+		// After the dump, the null handler mode applies again
+		_, ok := r.Handler(context.Background()).(*logctx.EarlyHandler)
+		return !ok
+	}, time.Second, time.Millisecond)
+	r.Debug(ctx, "dumped directly")
+
+	// Configured after the dump, ie: a slow loginit.Init
+	th := logtest.NewTestHandler(t)
+	r.SetDefaultHandler(th.H)
+	r.Debug(ctx, "filtered by the default handler")
+	r.Info(ctx, "configured")
+	th.RequireLine(slog.LevelInfo, "configured", "attr0", "foo")
+
+	os.Stderr = prevStderr
+	require.NoError(t, pw.Close())
+	out, err := io.ReadAll(pr)
+	require.NoError(t, err)
+	require.Contains(t, string(out), "level=INFO source=")
+	require.Contains(t, string(out), "early_test.go:")
+	require.Contains(t, string(out), "msg=\"never configured\" attr0=foo\n")
+	require.Contains(t, string(out), "msg=\"dumped directly\" attr0=foo\n")
+	require.NotContains(t, string(out), "msg=configured")
+	require.NotContains(t, string(out), "filtered")
+
+	// Later default handlers are followed too
+	th2 := logtest.NewTestHandler(t)
+	r.SetDefaultHandler(th2.H)
+	r.Info(ctx, "reconfigured")
+	th2.RequireLine(slog.LevelInfo, "reconfigured", "attr0", "foo")
+	th.RequireEOF()
+}
+
+func dropTime(_ []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.TimeKey {
+		return slog.Attr{}
+	}
+	return a
+}
@@ -0,0 +1,142 @@
+package logctx
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+)
+
+/*
+
+Interoperability with the context loggers of other libraries, without depending on them
+
+A fallback derives a handler from another library's context logger, for contexts that were
+set up by code using that library, ie: with logr:
+
+	logctx.AddFallback(func(ctx context.Context) (slog.Handler, bool) {
+		l, err := logr.FromContext(ctx)
+		if err != nil {
+			return nil, false
+		}
+		return logr.ToSlogHandler(l), true
+	})
+
+An exporter stores the handler as another library's context logger, ie: with logr:
+
+	logctx.AddExporter(func(ctx context.Context, h slog.Handler) context.Context {
+		return logr.NewContext(ctx, logr.FromSlogHandler(h))
+	})
+
+Exported loggers are created when the other library first looks for one in a logctx context,
+the contexts returned by logctx aren't wrapped further.  The handler is still stored under
+contextKey, so copies of this module from other versions keep finding it.
+
+*/
+
+// Returns a handler for a context that has no logctx handler, or false
+type Fallback func(ctx context.Context) (slog.Handler, bool)
+
+// Returns ctx with h stored as another library's context logger
+// ctx doesn't support anything but Value, and is only used to find the stored value
+// The same keys must be stored regardless of h
+type Exporter func(ctx context.Context, h slog.Handler) context.Context
+
+// Like the package level AddFallback, fallbacks are tried in the order added
+func (r *Registry) AddFallback(f Fallback) (remove func()) {
+	r.hooksMu.Lock()
+	defer r.hooksMu.Unlock()
+	var fs []*Fallback
+	if p := r.fallbacks.Load(); p != nil {
+		fs = *p
+	}
+	added := &f
+	fs = append(slices.Clip(fs), added)
+	r.fallbacks.Store(&fs)
+
+	return func() {
+		r.hooksMu.Lock()
+		defer r.hooksMu.Unlock()
+		fs := slices.DeleteFunc(slices.Clone(*r.fallbacks.Load()), func(f *Fallback) bool { return f == added })
+		r.fallbacks.Store(&fs)
+	}
+}
+
+// The exporters of a registry
+type exporterSet struct {
+	exporters []Exporter
+
+	// The exporters applied to a placeholder handler, tells which keys they store
+	// so that other lookups don't build exportedCtx
+	probe context.Context
+}
+
+// Like the package level AddExporter
+func (r *Registry) AddExporter(e Exporter) {
+	r.hooksMu.Lock()
+	defer r.hooksMu.Unlock()
+	var es []Exporter
+	if p := r.exporters.Load(); p != nil {
+		es = p.exporters
+	}
+	es = append(slices.Clip(es), e)
+	var probe context.Context = probeCtx{context.Background()}
+	for _, f := range es {
+		probe = f(probe, dropHandler{})
+	}
+	r.exporters.Store(&exporterSet{exporters: es, probe: probe})
+}
+
+func (r *Registry) fallbackHandler(ctx context.Context) slog.Handler {
+	p := r.fallbacks.Load()
+	if p == nil {
+		return nil
+	}
+	for _, f := range *p {
+		if h, ok := (*f)(ctx); ok && h != nil {
+			return h
+		}
+	}
+	return nil
+}
+
+// The values stored by the exporters for a node, built the first time a key is looked up
+type exportedCtx struct {
+	exporters *exporterSet // Rebuilt if exporters are added
+	ctx       context.Context
+}
+
+// Marks values that no exporter stored
+type probeMiss struct{}
+
+// Base of exportedCtx.ctx
+type probeCtx struct {
+	context.Context
+}
+
+func (probeCtx) Value(any) any {
+	return probeMiss{}
+}
+
+func (r *Registry) exportedValue(n *ctxNode, key any) (any, bool) {
+	ep := r.exporters.Load()
+	if ep == nil {
+		return nil, false
+	}
+	if _, miss := ep.probe.Value(key).(probeMiss); miss {
+		return nil, false // Not stored by any exporter, ie: the context package's own keys
+	}
+	e := n.exported.Load()
+	if e == nil || e.exporters != ep {
+		var ctx context.Context = probeCtx{context.Background()}
+		for _, f := range ep.exporters {
+			ctx = f(ctx, n.after)
+		}
+		e = &exportedCtx{exporters: ep, ctx: ctx}
+		n.exported.Store(e)
+	}
+	v := e.ctx.Value(key)
+	if _, miss := v.(probeMiss); miss {
+		return nil, false
+	}
+	return v, true
+}
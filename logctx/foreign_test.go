@@ -0,0 +1,80 @@
+package logctx_test
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/croepha/go-logging-extras/logctx"
+	"github.com/croepha/go-logging-extras/logtest"
+	"github.com/stretchr/testify/require"
+)
+
+// Like another library's context logger, ie: logr.FromContext
+type foreignKey struct{}
+
+type foreignLogger struct {
+	h slog.Handler
+}
+
+func foreignNewContext(ctx context.Context, l *foreignLogger) context.Context {
+	return context.WithValue(ctx, foreignKey{}, l)
+}
+
+func foreignFromContext(ctx context.Context) (*foreignLogger, bool) {
+	l, ok := ctx.Value(foreignKey{}).(*foreignLogger)
+	return l, ok
+}
+
+func TestForeign(t *testing.T) {
+	r := logctx.NewRegistry("foreign")
+	removeFallback := r.AddFallback(func(ctx context.Context) (slog.Handler, bool) {
+		if l, ok := foreignFromContext(ctx); ok {
+			return l.h, true
+		}
+		return nil, false
+	})
+
+	// Contexts set up by the other library
+	foreign := logtest.NewTestHandler(t)
+	ctx := foreignNewContext(context.Background(), &foreignLogger{h: foreign.H})
+	r.Info(ctx, "fallback test")
+	foreign.RequireLine(slog.LevelInfo, "fallback test")
+	r.Info(r.Attr(ctx, "attr0", "foo"), "fallback test")
+	foreign.RequireLine(slog.LevelInfo, "fallback test", "attr0", "foo")
+
+	// The other library finds the handler of logctx contexts
+	exported := 0
+	r.AddExporter(func(ctx context.Context, h slog.Handler) context.Context {
+		exported++
+		return foreignNewContext(ctx, &foreignLogger{h: h})
+	})
+	th := logtest.NewTestHandler(t)
+	ctx = r.Attr(r.Context(ctx, th.H), "attr0", "foo")
+	l, ok := foreignFromContext(ctx)
+	require.True(t, ok)
+	slog.New(l.h).InfoContext(ctx, "exporter test")
+	th.RequireLine(slog.LevelInfo, "exporter test", "attr0", "foo")
+
+	// Still found with the shared key
+	h, ok := logctx.NewRegistry("foreign").FromContext(ctx)
+	require.True(t, ok)
+	require.Same(t, l.h, h)
+
+	// Values the exporters don't store are still found, without running the exporters
+	ctx = context.WithValue(ctx, principalKey{}, "alice")
+	exported = 0
+	cctx, cancel := context.WithCancel(r.Attr(ctx, "attr1", "bar")) // Looks up the context package's key
+	defer cancel()
+	require.Equal(t, "alice", cctx.Value(principalKey{}))
+	require.Zero(t, exported)
+	_, ok = foreignFromContext(context.Background())
+	require.False(t, ok)
+
+	removeFallback()
+	nctx := foreignNewContext(context.Background(), &foreignLogger{h: foreign.H})
+	_, ok = r.Lookup(nctx)
+	require.False(t, ok)
+}
+
+type principalKey struct{}
@@ -0,0 +1,72 @@
+package logctx_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"testing/slogtest"
+
+	"github.com/croepha/go-logging-extras/logctx"
+	"github.com/croepha/go-logging-extras/logtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroup(t *testing.T) {
+	th := logtest.NewTestHandler(t)
+	ctx := logctx.Context(context.Background(), th.H)
+
+	ctx = logctx.Attr(ctx, "attr0", "foo")
+	require.Equal(t, []slog.Attr{slog.String("attr0", "foo")}, logctx.Attrs(logctx.Group(logctx.Group(ctx, "empty"), "")))
+
+	ctx = logctx.Group(ctx, "job")
+	ctx = logctx.Attr(ctx, "step", 1)
+	ctx = logctx.ReplaceAttr(ctx, "attr0", "bar") // Different group than the first attr0
+	ctx = logctx.ReplaceAttr(ctx, "step", 2)
+
+	logctx.Info(ctx, "group test", "attr1", 10)
+	th.RequireLine(slog.LevelInfo, "group test", "attr0", "foo", "job", map[string]any{"attr0": "bar", "step": 2, "attr1": 10})
+
+	require.Equal(t, []slog.Attr{
+		slog.String("attr0", "foo"),
+		slog.Group("job", "attr0", "bar", "step", 2),
+	}, logctx.Attrs(ctx))
+}
+
+// Implements slog.Handler only using the logctx functions
+type ctxAdapter struct {
+	ctx context.Context
+}
+
+func (a ctxAdapter) Enabled(ctx context.Context, l slog.Level) bool {
+	return logctx.Handler(a.ctx).Enabled(a.ctx, l)
+}
+
+func (a ctxAdapter) Handle(ctx context.Context, r slog.Record) error {
+	return logctx.Handler(a.ctx).Handle(a.ctx, r)
+}
+
+func (a ctxAdapter) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return ctxAdapter{logctx.WithAttrs(a.ctx, attrs...)}
+}
+
+func (a ctxAdapter) WithGroup(name string) slog.Handler {
+	return ctxAdapter{logctx.Group(a.ctx, name)}
+}
+
+func TestSlogtest(t *testing.T) {
+	for _, replace := range []bool{false, true} {
+		logctx.SetReplaceSameKey(replace)
+		var buf bytes.Buffer
+		slogtest.Run(t, func(*testing.T) slog.Handler {
+			buf.Reset()
+			return ctxAdapter{logctx.Context(context.Background(), slog.NewJSONHandler(&buf, nil))}
+		}, func(t *testing.T) map[string]any {
+			m := map[string]any{}
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &m))
+			return m
+		})
+	}
+	logctx.SetReplaceSameKey(false)
+}
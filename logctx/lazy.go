@@ -0,0 +1,99 @@
+package logctx
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+)
+
+// Returns true if a record at level would be logged with the handler from ctx
+// Use it to guard expensive logging, arguments passed to Debug and friends are allocated
+// even when the record ends up being dropped:
+//
+//	if logctx.Enabled(ctx, slog.LevelDebug) {
+//		logctx.Debug(ctx, "state", "dump", expensiveDump())
+//	}
+func Enabled(ctx context.Context, level slog.Level) bool {
+	return Handler(ctx).Enabled(ctx, level)
+}
+
+// Returns context with an attribute whose value is computed by calling fn every time a
+// record is logged, ie: time since the request started or the current retry count.
+// fn is given the context the record was logged with, and isn't called for disabled records.
+func Lazy(ctx context.Context, name string, fn func(ctx context.Context) slog.Value) context.Context {
+	return defaultRegistry.Lazy(ctx, name, fn)
+}
+
+// Like the package level Lazy
+func (r *Registry) Lazy(ctx context.Context, name string, fn func(ctx context.Context) slog.Value) context.Context {
+	return r.pushNode(ctx, &ctxNode{kind: wrapNode, wrap: func(h slog.Handler, _ *ctxNode) slog.Handler {
+		return &lazyHandler{next: h, name: name, fn: fn}
+	}})
+}
+
+// Adds the lazy attribute to each record
+// Record attributes are nested in the groups opened on the handler, so once a group is opened
+// the following changes are kept in ops and applied to the record instead of to next,
+// this keeps the lazy attribute outside of the group like any other attribute.
+type lazyHandler struct {
+	next slog.Handler
+	name string
+	fn   func(ctx context.Context) slog.Value
+	ops  []handlerOp
+}
+
+// Either attrs or group is set
+type handlerOp struct {
+	attrs []slog.Attr
+	group string
+}
+
+func (h *lazyHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	return h.next.Enabled(ctx, l)
+}
+
+func (h *lazyHandler) Handle(ctx context.Context, r slog.Record) error {
+	attr := slog.Attr{Key: h.name, Value: h.fn(ctx)}
+	if len(h.ops) == 0 {
+		r = r.Clone()
+		r.AddAttrs(attr)
+		return h.next.Handle(ctx, r)
+	}
+
+	inner := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		inner = append(inner, a)
+		return true
+	})
+	for _, o := range slices.Backward(h.ops) {
+		if o.group != "" {
+			inner = []slog.Attr{{Key: o.group, Value: slog.GroupValue(inner...)}}
+		} else {
+			inner = slices.Concat(o.attrs, inner)
+		}
+	}
+
+	nr := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	nr.AddAttrs(attr)
+	nr.AddAttrs(inner...)
+	return h.next.Handle(ctx, nr)
+}
+
+func (h *lazyHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	r := *h
+	if len(h.ops) == 0 {
+		r.next = h.next.WithAttrs(attrs)
+	} else {
+		r.ops = slices.Concat(h.ops, []handlerOp{{attrs: slices.Clone(attrs)}})
+	}
+	return &r
+}
+
+func (h *lazyHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	r := *h
+	r.ops = slices.Concat(h.ops, []handlerOp{{group: name}})
+	return &r
+}
@@ -0,0 +1,52 @@
+package logctx_test
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/croepha/go-logging-extras/logctx"
+	"github.com/croepha/go-logging-extras/logtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLazy(t *testing.T) {
+	th := logtest.NewTestHandler(t)
+	ctx := logctx.Context(context.Background(), th.H)
+
+	calls := 0
+	ctx = logctx.Lazy(ctx, "calls", func(context.Context) slog.Value {
+		calls++
+		return slog.IntValue(calls)
+	})
+	ctx = logctx.Attr(ctx, "attr0", "foo")
+
+	logctx.Debug(ctx, "not logged")
+	th.RequireEOF()
+	require.Equal(t, 0, calls)
+
+	logctx.Info(ctx, "lazy test")
+	th.RequireLine(slog.LevelInfo, "lazy test", "attr0", "foo", "calls", 1)
+
+	ctx = logctx.Group(ctx, "job")
+	ctx = logctx.Attr(ctx, "attr1", "bar")
+	logctx.Info(ctx, "lazy test", "attr2", 10)
+	th.RequireLine(slog.LevelInfo, "lazy test", "attr0", "foo", "calls", 2, "job", map[string]any{"attr1": "bar", "attr2": 10})
+}
+
+func TestEnabled(t *testing.T) {
+	th := logtest.NewTestHandler(t)
+	ctx := logctx.Context(context.Background(), th.H)
+
+	require.False(t, logctx.Enabled(ctx, slog.LevelDebug))
+	require.True(t, logctx.Enabled(logctx.WithLevel(ctx, slog.LevelDebug), slog.LevelDebug))
+
+	i := 1000
+	allocs := testing.AllocsPerRun(100, func() {
+		i++
+		if logctx.Enabled(ctx, slog.LevelDebug) {
+			logctx.Debug(ctx, "not logged", "i", i)
+		}
+	})
+	require.Zero(t, allocs)
+}
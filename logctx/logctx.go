@@ -4,7 +4,6 @@ import (
 	"context"
 	"log/slog"
 
-	"github.com/croepha/go-logging-extras/internal"
 	"github.com/croepha/go-logging-extras/logwrap"
 )
 
@@ -19,7 +18,7 @@ Handler from ctx
 You must ensure that either:
   - all ctxs used for logging have a Handler set
   - DefaultHandler is set
-otherwise, logs will be silently dropped, or painic if PancOnNullHandler is set
+otherwise, logs will be silently dropped, or handled according to SetNullHandlerMode
 
 */
 
@@ -28,51 +27,141 @@ otherwise, logs will be silently dropped, or painic if PancOnNullHandler is set
 // so that we can intentially allow other packages to use this value.
 // So in-theory, we could have multiple versions or copies of this module imported by
 // different modules, and still be compatible with eachother
-var contextKey = "slog.Handler-7263656f68700a61"
+// Stored as an any so that looking up the handler doesn't allocate
+var contextKey any = "slog.Handler-7263656f68700a61"
 
+// Deprecated: Not safe to change while logging, use SetDefaultHandler
+// Used by the default registry if SetDefaultHandler hasn't been called
 var DefaultHandler slog.Handler
 
+// Deprecated: Not safe to change while logging, use SetPanicOnNullHandler
+// Used by the default registry in addition to SetPanicOnNullHandler
 var PanicOnNullHandler bool
 
+// Sets the handler used for contexts that don't have one, see Registry.SetDefaultHandler
+func SetDefaultHandler(h slog.Handler) { defaultRegistry.SetDefaultHandler(h) }
+
+// Panic when there is no handler in the context and no default handler, see Registry.SetPanicOnNullHandler
+func SetPanicOnNullHandler(v bool) { defaultRegistry.SetPanicOnNullHandler(v) }
+
+// Sets what Handler does when there is no handler in the context and no default handler,
+// see Registry.SetNullHandlerMode
+func SetNullHandlerMode(mode NullHandlerMode) { defaultRegistry.SetNullHandlerMode(mode) }
+
+// Returns the call sites that logged with no handler while in NullWarn mode, see Registry.VoidCallSites
+func VoidCallSites() []VoidCallSite { return defaultRegistry.VoidCallSites() }
+
+// If set, Attr, WithAttrs and Key.Set replace attributes with the same key instead of adding another one
+// see ReplaceAttr
+func SetReplaceSameKey(v bool) { defaultRegistry.SetReplaceSameKey(v) }
+
 // Gets Handler from context (or use the default if one isn't set)
 func Handler(ctx context.Context) slog.Handler {
-	v, _ := ctx.Value(contextKey).(slog.Handler)
-	if v == nil {
-		v = DefaultHandler
-		if v == nil {
-			if PanicOnNullHandler {
-				panic("No handler in context and not DefaultHandler set")
-			}
-			v = &internal.NullHandler{}
-		}
-	}
-	return v
+	return defaultRegistry.Handler(ctx)
 }
 
-// Creates a new context with the given handler added to it
-func Context(ctx context.Context, handler slog.Handler) context.Context {
+// Gets the Handler from context, without using the default if one isn't set
+func FromContext(ctx context.Context) (slog.Handler, bool) {
+	return defaultRegistry.FromContext(ctx)
+}
 
-	// Prevent recursive use
-	if _, ok := handler.(interface{ CannotBeLogCtxHandler() }); ok {
-		panic("CannotBeLogCtxHandler handler used at logCtx handler")
-	}
+// Gets the Handler from context, or from a fallback (see AddFallback), without using the default
+// or null handler if neither has one
+func Lookup(ctx context.Context) (slog.Handler, bool) {
+	return defaultRegistry.Lookup(ctx)
+}
 
-	//lint:ignore SA1029 collisions are a feature see contextKey comment
-	return context.WithValue(ctx, contextKey, handler)
+// Adds a function that Handler uses when the context has no handler, before the default handler,
+// ie: to use a handler derived from another library's context logger, see Registry.AddFallback
+// remove undoes it
+func AddFallback(f Fallback) (remove func()) { return defaultRegistry.AddFallback(f) }
+
+// Adds a function that makes the handler from logctx contexts available to another library,
+// see Registry.AddExporter
+func AddExporter(e Exporter) { defaultRegistry.AddExporter(e) }
+
+// Creates a new context with the given handler added to it
+func Context(ctx context.Context, handler slog.Handler) context.Context {
+	return defaultRegistry.Context(ctx, handler)
 }
 
 // Returns context with added slog attribute
+// the attribute can be read back with Attrs
 func Attr(ctx context.Context, name string, value any) context.Context {
-	return Context(ctx,
-		Handler(ctx).WithAttrs(
-			[]slog.Attr{
-				slog.Any(name, value),
-			},
-		),
-	)
+	return defaultRegistry.Attr(ctx, name, value)
+}
+
+// Returns context with added slog attributes
+// the attributes can be read back with Attrs
+func WithAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	return defaultRegistry.WithAttrs(ctx, attrs...)
+}
+
+// Like Attr, but if the context already has an attribute with the same key, it is replaced
+// instead of being output twice.  This keeps contexts that are updated in a loop from
+// growing, ie: ctx = logctx.ReplaceAttr(ctx, "step", step)
+//
+// Replacing requires rebuilding the handler from the point where the previous value
+// was added, and only works for attributes added with this package since the last call to
+// Context, otherwise the attribute is added like with Attr.
+func ReplaceAttr(ctx context.Context, name string, value any) context.Context {
+	return defaultRegistry.ReplaceAttr(ctx, name, value)
+}
+
+// Returns context with a group opened, attributes added to the context afterwards and the
+// attributes of records logged with it are nested in the group
+func Group(ctx context.Context, name string) context.Context {
+	return defaultRegistry.Group(ctx, name)
+}
+
+// Returns the attributes added to the context with Attr, WithAttrs or Key.Set, in the order added
+// Attributes added after Group are nested in a group attribute, empty groups are omitted
+// Only attributes emitted by the context's handler are returned, those added before a
+// handler was set with Context aren't, unless that handler was Handler(ctx)
+func Attrs(ctx context.Context) []slog.Attr {
+	return defaultRegistry.Attrs(ctx)
+}
+
+// Returns context with a minimum level override, records at or above level are
+// enabled for this context regardless of the level configured on the handler.
+// Useful for turning on debug logging for a single request.
+func WithLevel(ctx context.Context, level slog.Leveler) context.Context {
+	return defaultRegistry.WithLevel(ctx, level)
+}
+
+// Like the package level WithLevel
+func (r *Registry) WithLevel(ctx context.Context, level slog.Leveler) context.Context {
+	return r.pushNode(ctx, &ctxNode{kind: wrapNode, wrap: func(h slog.Handler, _ *ctxNode) slog.Handler {
+		if lh, ok := h.(*levelHandler); ok {
+			h = lh.next // Replace previous override instead of stacking them
+		}
+		return &levelHandler{next: h, level: level}
+	}})
+}
+
+type levelHandler struct {
+	next  slog.Handler
+	level slog.Leveler
+}
+
+func (h *levelHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level.Level()
+}
+
+func (h *levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.next.Handle(ctx, r)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{next: h.next.WithAttrs(attrs), level: h.level}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{next: h.next.WithGroup(name), level: h.level}
 }
 
 // Log a Debug record using handler from context
+// args are allocated even if the record is dropped, see Enabled
 func Debug(ctx context.Context, msg string, args ...any) {
 	logwrap.Log(ctx, Handler(ctx), 1, slog.LevelDebug, args, msg)
 }
@@ -19,3 +19,31 @@ func Test(t *testing.T) {
 	logctx.Info(ctx, "info test", "attr0", "foo")
 	th.RequireLine(slog.LevelInfo, "info test", "attr0", "foo")
 }
+
+func TestWithLevel(t *testing.T) {
+	ctx := context.Background()
+	th := logtest.NewTestHandler(t)
+
+	ctx = logctx.Context(ctx, th.H)
+	debugCtx := logctx.WithLevel(logctx.Attr(ctx, "attr0", "foo"), slog.LevelDebug)
+
+	logctx.Debug(ctx, "not logged")
+	th.RequireEOF()
+
+	logctx.Debug(debugCtx, "debug test")
+	th.RequireLine(slog.LevelDebug, "debug test", "attr0", "foo")
+
+	logctx.Debug(logctx.Attr(debugCtx, "attr1", "bar"), "debug test")
+	th.RequireLine(slog.LevelDebug, "debug test", "attr0", "foo", "attr1", "bar")
+
+	quietCtx := logctx.WithLevel(debugCtx, slog.LevelWarn)
+	logctx.Info(quietCtx, "not logged")
+	th.RequireEOF()
+
+	allocs := testing.AllocsPerRun(100, func() {
+		logctx.Debug(ctx, "not logged")
+	})
+	if allocs != 0 {
+		t.Fatalf("disabled Debug allocated %v times", allocs)
+	}
+}
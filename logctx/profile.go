@@ -0,0 +1,127 @@
+package logctx
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"math"
+	"runtime/pprof"
+	"runtime/trace"
+	"slices"
+	"sync"
+)
+
+// Attributes with these keys that are added with Attr, WithAttrs or Key.Set are also added to
+// the context as runtime/pprof labels, so profiles can be correlated with the logs.  The labels
+// apply to goroutines started with pprof.Do or after pprof.SetGoroutineLabels(ctx)
+// see Registry.SetProfileLabels
+func SetProfileLabels(keys ...string) { defaultRegistry.SetProfileLabels(keys...) }
+
+// Like the package level SetProfileLabels
+func (r *Registry) SetProfileLabels(keys ...string) {
+	if len(keys) == 0 {
+		r.profileLabelKeys.Store(nil)
+		return
+	}
+	keys = slices.Clone(keys)
+	r.profileLabelKeys.Store(&keys)
+}
+
+func (r *Registry) withProfileLabels(ctx context.Context, attrs []slog.Attr) context.Context {
+	keys := r.profileLabelKeys.Load()
+	if keys == nil {
+		return ctx
+	}
+	var labels []string
+	for _, a := range attrs {
+		if slices.Contains(*keys, a.Key) {
+			labels = append(labels, a.Key, a.Value.String())
+		}
+	}
+	if len(labels) == 0 {
+		return ctx
+	}
+	c, ok := ctx.(*logCtx)
+	if !ok {
+		return pprof.WithLabels(ctx, pprof.Labels(labels...))
+	}
+
+	// Keep c outermost and replace the labels added before, so withNode can still collapse
+	// the context and it doesn't keep growing, like with ReplaceAttr in a loop
+	base := c.Context
+	if lc, ok := base.(*labelCtx); ok {
+		base = lc.base
+	}
+	merged := map[string]string{}
+	pprof.ForLabels(c.Context, func(k, v string) bool {
+		merged[k] = v
+		return true
+	})
+	for i := 0; i < len(labels); i += 2 {
+		merged[labels[i]] = labels[i+1]
+	}
+	all := make([]string, 0, 2*len(merged))
+	for k, v := range merged {
+		all = append(all, k, v)
+	}
+	lc := &labelCtx{Context: pprof.WithLabels(base, pprof.Labels(all...)), base: base}
+	return &logCtx{Context: lc, reg: c.reg, node: c.node}
+}
+
+// Holds the labels added by withProfileLabels, base is the context without them
+type labelCtx struct {
+	context.Context
+	base context.Context
+}
+
+// Create a new handler instance
+// Records handled while a runtime/trace is running are also emitted as trace log events,
+// in the task of the record's context, with the level as the category
+func NewTraceHandler(next slog.Handler) slog.Handler {
+	s := &traceShared{}
+	return &traceHandler{next: next, shared: s, text: slog.NewTextHandler(&s.buf, &slog.HandlerOptions{
+		Level: slog.Level(math.MinInt),
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey) {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})}
+}
+
+// Formats the trace events
+type traceShared struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+type traceHandler struct {
+	next   slog.Handler
+	shared *traceShared
+	text   slog.Handler
+}
+
+func (h *traceHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	return h.next.Enabled(ctx, l)
+}
+
+func (h *traceHandler) Handle(ctx context.Context, r slog.Record) error {
+	if trace.IsEnabled() {
+		h.shared.mu.Lock()
+		_ = h.text.Handle(ctx, r)
+		msg := string(bytes.TrimSuffix(h.shared.buf.Bytes(), []byte("\n")))
+		h.shared.buf.Reset()
+		h.shared.mu.Unlock()
+		trace.Log(ctx, r.Level.String(), msg)
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *traceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &traceHandler{next: h.next.WithAttrs(attrs), shared: h.shared, text: h.text.WithAttrs(attrs)}
+}
+
+func (h *traceHandler) WithGroup(name string) slog.Handler {
+	return &traceHandler{next: h.next.WithGroup(name), shared: h.shared, text: h.text.WithGroup(name)}
+}
@@ -0,0 +1,46 @@
+package logctx_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"runtime/pprof"
+	"runtime/trace"
+	"testing"
+
+	"github.com/croepha/go-logging-extras/logctx"
+	"github.com/croepha/go-logging-extras/logtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfileLabels(t *testing.T) {
+	r := logctx.NewRegistry("profile")
+	r.SetProfileLabels("tenant")
+	ctx := r.Context(context.Background(), logtest.NewTestHandler(t).H)
+
+	ctx = r.Attr(ctx, "tenant", "acme")
+	ctx = r.WithAttrs(ctx, slog.Int("user_id", 42))
+	ctx = r.ReplaceAttr(ctx, "tenant", "umbrella")
+
+	v, _ := pprof.Label(ctx, "tenant")
+	require.Equal(t, "umbrella", v)
+	_, ok := pprof.Label(ctx, "user_id")
+	require.False(t, ok)
+	require.Equal(t, []slog.Attr{slog.Int("user_id", 42), slog.String("tenant", "umbrella")}, r.Attrs(ctx))
+}
+
+func TestTraceHandler(t *testing.T) {
+	th := logtest.NewTestHandler(t)
+	ctx := logctx.Context(context.Background(), logctx.NewTraceHandler(th.H))
+	ctx = logctx.Attr(ctx, "attr0", "foo")
+
+	var buf bytes.Buffer
+	require.NoError(t, trace.Start(&buf))
+	ctx, task := trace.NewTask(ctx, "test")
+	logctx.Info(ctx, "trace test", "attr1", "bar")
+	th.RequireLine(slog.LevelInfo, "trace test", "attr0", "foo", "attr1", "bar")
+	task.End()
+	trace.Stop()
+
+	require.Contains(t, buf.String(), `msg="trace test" attr0=foo attr1=bar`)
+}
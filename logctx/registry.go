@@ -0,0 +1,228 @@
+package logctx
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/croepha/go-logging-extras/logwrap"
+)
+
+/*
+
+A Registry holds the defaults used when a context doesn't have a handler, and the
+context keys the handler is kept under.  The package level functions use the default
+registry, libraries and tests can create their own to have isolated defaults.
+
+*/
+
+// Holds defaults and context keys, safe for concurrent use
+type Registry struct {
+	handlerKey, nodesKey any
+
+	defaultHandler   atomic.Pointer[slog.Handler]
+	early            atomic.Pointer[EarlyHandler]
+	nullMode         atomic.Int32 // NullHandlerMode
+	replaceSameKey   atomic.Bool
+	profileLabelKeys atomic.Pointer[[]string]
+	void             voidSites
+	fallbacks        atomic.Pointer[[]*Fallback] // Pointers so they can be removed
+	exporters        atomic.Pointer[exporterSet]
+	hooksMu          sync.Mutex // Serializes AddFallback and AddExporter
+
+	legacy bool // Also uses the DefaultHandler and PanicOnNullHandler vars
+}
+
+var defaultRegistry = func() *Registry {
+	r := &Registry{handlerKey: contextKey, nodesKey: nodesContextKey, legacy: true}
+	r.SetEarlyHandler(NewEarlyHandler(1000, 10*time.Second))
+	return r
+}()
+
+// Returns the registry used by the package level functions
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// Creates a new registry with its own defaults
+// If namespace is "", handlers are kept under the same context keys as the package level
+// functions use, so contexts are shared with them.  Otherwise handlers are kept separately,
+// so that for example a library can have its own handler in contexts it is given.
+func NewRegistry(namespace string) *Registry {
+	r := &Registry{handlerKey: contextKey, nodesKey: nodesContextKey}
+	if namespace != "" {
+		r.handlerKey = contextKey.(string) + "/" + namespace
+		r.nodesKey = nodesContextKey.(string) + "/" + namespace
+	}
+	return r
+}
+
+// Sets the handler used for contexts that don't have one, nil unsets it
+// Records kept by the early handler are replayed into h, and handlers derived from
+// the early handler forward to h from now on
+func (r *Registry) SetDefaultHandler(h slog.Handler) {
+	if h == nil {
+		r.defaultHandler.Store(nil)
+		return
+	}
+	r.defaultHandler.Store(&h)
+	if e := r.early.Load(); e != nil {
+		e.redirect(h)
+	}
+}
+
+// Sets a handler that is used for contexts that don't have one until a default handler is set,
+// the default registry has one that keeps 1000 records and dumps them to stderr after 10s.
+// It isn't used in the NullPanic and NullWarn modes.  nil removes it
+func (r *Registry) SetEarlyHandler(h *EarlyHandler) {
+	r.early.Store(h)
+}
+
+// Returns the handler set with SetEarlyHandler, or nil
+func (r *Registry) EarlyHandler() *EarlyHandler {
+	return r.early.Load()
+}
+
+func (r *Registry) replayEarly(h slog.Handler) {
+	if e := r.early.Load(); e != nil && !e.replayed() {
+		e.Replay(h)
+	}
+}
+
+// Returns the handler used for contexts that don't have one, or nil
+func (r *Registry) DefaultHandler() slog.Handler {
+	if h := r.defaultHandler.Load(); h != nil {
+		return *h
+	}
+	if r.legacy {
+		return DefaultHandler
+	}
+	return nil
+}
+
+// If set, Handler panics when there is no handler in the context and no default handler,
+// otherwise records are silently dropped.  Same as SetNullHandlerMode with NullPanic or NullDrop
+func (r *Registry) SetPanicOnNullHandler(v bool) {
+	if v {
+		r.SetNullHandlerMode(NullPanic)
+	} else {
+		r.SetNullHandlerMode(NullDrop)
+	}
+}
+
+// Sets what Handler does when there is no handler in the context and no default handler
+func (r *Registry) SetNullHandlerMode(mode NullHandlerMode) {
+	r.nullMode.Store(int32(mode))
+}
+
+// If set, Attr, WithAttrs and Key.Set replace attributes with the same key instead of adding another one
+func (r *Registry) SetReplaceSameKey(v bool) {
+	r.replaceSameKey.Store(v)
+}
+
+// Like the package level FromContext
+func (r *Registry) FromContext(ctx context.Context) (slog.Handler, bool) {
+	v, _ := ctx.Value(r.handlerKey).(slog.Handler)
+	return v, v != nil
+}
+
+// Like the package level Lookup
+func (r *Registry) Lookup(ctx context.Context) (slog.Handler, bool) {
+	if v, ok := r.FromContext(ctx); ok {
+		return v, true
+	}
+	v := r.fallbackHandler(ctx)
+	return v, v != nil
+}
+
+// Like the package level Handler
+func (r *Registry) Handler(ctx context.Context) slog.Handler {
+	v, _ := r.Lookup(ctx)
+	if v == nil {
+		v = r.DefaultHandler()
+		if v != nil {
+			r.replayEarly(v) // In case the legacy var was set
+		} else {
+			v = r.nullHandler()
+		}
+	}
+	return v
+}
+
+// Used when there is no handler at all, the early handler only replaces dropping records
+func (r *Registry) nullHandler() slog.Handler {
+	switch mode := NullHandlerMode(r.nullMode.Load()); {
+	case mode == NullPanic || (r.legacy && PanicOnNullHandler):
+		panic("No handler in context and not DefaultHandler set")
+	case mode == NullWarn:
+		return &voidHandler{sites: &r.void}
+	}
+	if e := r.early.Load(); e != nil && e.pending() {
+		return e
+	}
+	return dropHandler{}
+}
+
+// Like the package level Context
+func (r *Registry) Context(ctx context.Context, handler slog.Handler) context.Context {
+
+	// Prevent recursive use
+	if _, ok := handler.(interface{ CannotBeLogCtxHandler() }); ok {
+		panic("CannotBeLogCtxHandler handler used at logCtx handler")
+	}
+
+	return r.withNode(ctx, &ctxNode{kind: baseNode, parent: r.nodeList(ctx), after: handler})
+}
+
+// Like the package level Attr
+func (r *Registry) Attr(ctx context.Context, name string, value any) context.Context {
+	return r.addAttrs(ctx, []slog.Attr{slog.Any(name, value)}, []any{value}, r.replaceSameKey.Load())
+}
+
+// Like the package level WithAttrs
+func (r *Registry) WithAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	attrs = slices.DeleteFunc(slices.Clone(attrs), func(a slog.Attr) bool {
+		return a.Equal(slog.Attr{}) // Ignored by handlers
+	})
+	raws := make([]any, len(attrs))
+	for i, a := range attrs {
+		raws[i] = a.Value.Any()
+	}
+	return r.addAttrs(ctx, attrs, raws, r.replaceSameKey.Load())
+}
+
+// Like the package level ReplaceAttr
+func (r *Registry) ReplaceAttr(ctx context.Context, name string, value any) context.Context {
+	return r.addAttrs(ctx, []slog.Attr{slog.Any(name, value)}, []any{value}, true)
+}
+
+// Like the package level Group
+func (r *Registry) Group(ctx context.Context, name string) context.Context {
+	if name == "" {
+		return ctx // Same as slog.Handler.WithGroup
+	}
+	return r.pushNode(ctx, &ctxNode{kind: groupNode, group: name})
+}
+
+// Log a Debug record using handler from context
+func (r *Registry) Debug(ctx context.Context, msg string, args ...any) {
+	logwrap.Log(ctx, r.Handler(ctx), 1, slog.LevelDebug, args, msg)
+}
+
+// Log an Info record using handler from context
+func (r *Registry) Info(ctx context.Context, msg string, args ...any) {
+	logwrap.Log(ctx, r.Handler(ctx), 1, slog.LevelInfo, args, msg)
+}
+
+// Log a Warn record using handler from context
+func (r *Registry) Warn(ctx context.Context, msg string, args ...any) {
+	logwrap.Log(ctx, r.Handler(ctx), 1, slog.LevelWarn, args, msg)
+}
+
+// Log an Error record using handler from context
+func (r *Registry) Error(ctx context.Context, msg string, args ...any) {
+	logwrap.Log(ctx, r.Handler(ctx), 1, slog.LevelError, args, msg)
+}
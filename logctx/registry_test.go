@@ -0,0 +1,99 @@
+package logctx_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/croepha/go-logging-extras/logctx"
+	"github.com/croepha/go-logging-extras/logtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	ctx := context.Background()
+	th := logtest.NewTestHandler(t)
+	lib := logctx.NewRegistry("lib")
+
+	var libBuf bytes.Buffer
+	lib.SetDefaultHandler(slog.NewTextHandler(&libBuf, nil))
+
+	// Handlers and attributes of the namespaced registry are kept separately
+	ctx = logctx.Context(ctx, th.H)
+	ctx = lib.Attr(ctx, "lib_attr", "foo")
+	ctx = logctx.Attr(ctx, "attr0", "bar")
+
+	lib.Info(ctx, "lib test")
+	require.Contains(t, libBuf.String(), "msg=\"lib test\" lib_attr=foo\n")
+	require.NotContains(t, libBuf.String(), "attr0")
+
+	logctx.Info(ctx, "info test")
+	th.RequireLine(slog.LevelInfo, "info test", "attr0", "bar")
+	require.Equal(t, []slog.Attr{slog.String("attr0", "bar")}, logctx.Attrs(ctx))
+	require.Equal(t, []slog.Attr{slog.String("lib_attr", "foo")}, lib.Attrs(ctx))
+
+	// No namespace shares the contexts of the package level functions
+	shared := logctx.NewRegistry("")
+	shared.Info(ctx, "shared test")
+	th.RequireLine(slog.LevelInfo, "shared test", "attr0", "bar")
+
+	// Without a default handler records are dropped, or it panics
+	empty := logctx.NewRegistry("empty")
+	empty.Info(context.Background(), "dropped")
+	empty.SetPanicOnNullHandler(true)
+	require.Panics(t, func() { empty.Info(context.Background(), "panics") })
+}
+
+func TestRegistryConcurrentDefault(t *testing.T) {
+	r := logctx.NewRegistry("concurrent")
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				if i%2 == 0 {
+					r.SetDefaultHandler(slog.NewJSONHandler(&bytes.Buffer{}, nil))
+				} else {
+					r.Handler(context.Background())
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRegistryKeys(t *testing.T) {
+	ctx := context.Background()
+	th := logtest.NewTestHandler(t)
+	lib := logctx.NewRegistry("lib")
+
+	ctx = lib.Context(ctx, th.H)
+	ctx = logctx.RequestIDKey.SetIn(ctx, lib, "req-1")
+	id, ok := logctx.RequestIDKey.GetIn(ctx, lib)
+	require.True(t, ok)
+	require.Equal(t, "req-1", id)
+	require.Empty(t, logctx.RequestID(ctx))
+
+	ctx, end := lib.Start(ctx, "op")
+	span, _ := logctx.SpanKey.GetIn(ctx, lib)
+	require.Equal(t, "op", span)
+	_, ok = logctx.SpanKey.Get(ctx)
+	require.False(t, ok)
+	defer end(nil)
+
+	// The other context helpers use the registry's handler and attributes too
+	ctx = lib.WithLevel(ctx, slog.LevelDebug)
+	ctx = lib.Lazy(ctx, "lazy", func(context.Context) slog.Value { return slog.IntValue(1) })
+	spanID, _ := logctx.SpanIDKey.GetIn(ctx, lib)
+	lib.Debug(logctx.Group(ctx, "ignored"), "debug test") // Only groups of the default registry
+	th.RequireLine(slog.LevelDebug, "debug test", "request_id", "req-1", "span", "op", "span_id", spanID, "lazy", 1)
+
+	ctx, c := lib.Capture(ctx, slog.LevelInfo)
+	lib.Info(ctx, "captured")
+	require.Contains(t, c.String(), `"msg":"captured","request_id":"req-1"`)
+	th.RequireLineExtra(-2, 0, slog.LevelInfo, "captured", "request_id", "req-1", "span", "op", "span_id", spanID, "lazy", 1)
+	th.RequireEOF()
+}
@@ -0,0 +1,20 @@
+package logctx
+
+import (
+	"context"
+)
+
+// Key used for request IDs
+var RequestIDKey = NewKey[string]("request_id")
+
+// Returns context with the given request ID added as an attribute
+// Used by loghttp and loggrpc to propagate request IDs
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return RequestIDKey.Set(ctx, id)
+}
+
+// Gets request ID from context, or "" if there isn't one
+func RequestID(ctx context.Context) string {
+	id, _ := RequestIDKey.Get(ctx)
+	return id
+}
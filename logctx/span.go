@@ -0,0 +1,115 @@
+package logctx
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/croepha/go-logging-extras/errordump"
+	"github.com/croepha/go-logging-extras/logwrap"
+)
+
+/*
+
+Lightweight spans, for reconstructing call trees from logs when there is no tracing backend
+
+Every record logged within a span has span, span_id and parent_span_id attributes, at the
+root of the record even when a group was opened with Group
+
+*/
+
+var (
+	SpanKey         = NewKey[string]("span")
+	SpanIDKey       = NewKey[string]("span_id")
+	ParentSpanIDKey = NewKey[string]("parent_span_id")
+)
+
+var logSpanStart atomic.Bool
+
+// If set, Start logs a "span start" record
+func SetLogSpanStart(v bool) { logSpanStart.Store(v) }
+
+func newSpanID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Starts a span named name, the returned context has a new span ID with the current span
+// as the parent.  end must be called once the operation is done, it logs a "span end" record
+// with the duration and outcome, if errp points to a non-nil error it is logged with errordump.
+// When end is deferred directly, panics are logged and re-panicked:
+//
+//	func fetchUser(ctx context.Context) (err error) {
+//		ctx, end := logctx.Start(ctx, "fetch-user")
+//		defer end(&err)
+func Start(ctx context.Context, name string) (context.Context, func(errp *error)) {
+	return defaultRegistry.start(ctx, name)
+}
+
+// Like the package level Start
+func (r *Registry) Start(ctx context.Context, name string) (context.Context, func(errp *error)) {
+	return r.start(ctx, name)
+}
+
+// Called directly by both Start functions, so the span start record has the right source
+func (r *Registry) start(ctx context.Context, name string) (context.Context, func(errp *error)) {
+	start := time.Now()
+	parent, _ := SpanIDKey.GetIn(ctx, r)
+
+	// Replaced so nested spans don't output the attributes multiple times
+	attrs := []slog.Attr{slog.String(SpanKey.Name(), name), slog.String(SpanIDKey.Name(), newSpanID())}
+	if parent != "" {
+		attrs = append(attrs, slog.String(ParentSpanIDKey.Name(), parent))
+	}
+	raws := make([]any, len(attrs))
+	for i, a := range attrs {
+		raws[i] = a.Value.Any()
+	}
+	if c, ok := r.rootAttrs(ctx, attrs, raws); ok {
+		ctx = r.withProfileLabels(c, attrs)
+	} else {
+		ctx = r.addAttrs(ctx, attrs, raws, true)
+	}
+
+	if logSpanStart.Load() {
+		logwrap.LogAttrs(ctx, r.Handler(ctx), 2, slog.LevelInfo, nil, "span start")
+	}
+
+	return ctx, func(errp *error) {
+		attrs := []slog.Attr{slog.Duration("duration", time.Since(start))}
+		level := slog.LevelInfo
+		outcome := "ok"
+
+		p := recover()
+		if p != nil {
+			level, outcome = slog.LevelError, "panic"
+			err, ok := p.(error)
+			if !ok {
+				err = fmt.Errorf("%v", p)
+			}
+			attrs = append(attrs, errordump.NewSlog("error", err))
+		} else if errp != nil && *errp != nil {
+			level, outcome = slog.LevelError, "error"
+			attrs = append(attrs, errordump.NewSlog("error", *errp))
+		}
+		attrs = append(attrs, slog.String("outcome", outcome))
+
+		// Also kept out of the context's groups, next to the span attributes
+		h := r.Handler(ctx)
+		if h.Enabled(ctx, level) && r.nodeList(ctx).inGroup() {
+			if c, ok := r.rootAttrs(ctx, attrs, make([]any, len(attrs))); ok {
+				h, attrs = r.Handler(c), nil
+			}
+		}
+		logwrap.LogAttrs(ctx, h, 1, level, attrs, "span end")
+
+		if p != nil {
+			panic(p)
+		}
+	}
+}
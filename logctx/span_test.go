@@ -0,0 +1,106 @@
+package logctx_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/croepha/go-logging-extras/logctx"
+	"github.com/croepha/go-logging-extras/logtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStart(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := logctx.Context(context.Background(), slog.NewJSONHandler(&buf, nil))
+
+	logctx.SetLogSpanStart(true)
+	defer logctx.SetLogSpanStart(false)
+
+	fetch := func(ctx context.Context) (err error) {
+		ctx, end := logctx.Start(ctx, "fetch-user")
+		defer end(&err)
+		logctx.Info(ctx, "fetching")
+		return errors.New("not found")
+	}
+	handle := func(ctx context.Context) {
+		ctx, end := logctx.Start(ctx, "handle")
+		defer end(nil)
+		_ = fetch(ctx)
+	}
+	handle(ctx)
+
+	type o = map[string]any
+	lines := logtest.JSONLines(t, &buf)
+	require.Len(t, lines, 5)
+
+	msgs := []string{"span start", "span start", "fetching", "span end", "span end"}
+	spans := []string{"handle", "fetch-user", "fetch-user", "fetch-user", "handle"}
+	for i, line := range lines {
+		require.Equal(t, msgs[i], line["msg"])
+		require.Equal(t, spans[i], line["span"])
+	}
+
+	handleID := lines[0]["span_id"]
+	require.NotContains(t, lines[0], "parent_span_id")
+	require.Equal(t, handleID, lines[1]["parent_span_id"])
+	require.NotEqual(t, handleID, lines[1]["span_id"])
+	require.Equal(t, lines[1]["span_id"], lines[2]["span_id"])
+
+	require.Equal(t, "ERROR", lines[3]["level"])
+	require.Equal(t, "error", lines[3]["outcome"])
+	require.Equal(t, "not found", lines[3]["error"].(o)["String"])
+	require.Contains(t, lines[3], "duration")
+
+	require.Equal(t, "INFO", lines[4]["level"])
+	require.Equal(t, "ok", lines[4]["outcome"])
+	require.Equal(t, handleID, lines[4]["span_id"])
+
+	require.PanicsWithValue(t, "oops", func() {
+		_, end := logctx.Start(ctx, "panics")
+		defer end(nil)
+		panic("oops")
+	})
+	lines = logtest.JSONLines(t, &buf)
+	require.Len(t, lines, 2)
+	require.Equal(t, "panic", lines[1]["outcome"])
+}
+
+// Span attributes stay at the root, so they are in the same place at every call depth
+func TestStartInGroup(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := logctx.Context(context.Background(), slog.NewJSONHandler(&buf, nil))
+
+	ctx, endOuter := logctx.Start(ctx, "outer")
+	ctx = logctx.Group(ctx, "job")
+	ctx = logctx.Attr(ctx, "step", 1)
+	inner, endInner := logctx.Start(ctx, "inner")
+	logctx.Info(inner, "working", "attr0", "foo")
+	endInner(nil)
+	endOuter(nil)
+
+	for _, l := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		require.Equal(t, 1, strings.Count(l, `"span_id":`), l)
+	}
+	type o = map[string]any
+	lines := logtest.JSONLines(t, &buf)
+	require.Len(t, lines, 3)
+
+	outerID := lines[2]["span_id"]
+	require.Equal(t, "inner", lines[0]["span"])
+	require.Equal(t, outerID, lines[0]["parent_span_id"])
+	require.Equal(t, o{"step": float64(1), "attr0": "foo"}, lines[0]["job"])
+
+	require.Equal(t, "span end", lines[1]["msg"])
+	require.Equal(t, "inner", lines[1]["span"])
+	require.Equal(t, lines[0]["span_id"], lines[1]["span_id"])
+	require.Equal(t, "ok", lines[1]["outcome"])
+	require.Contains(t, lines[1], "duration")
+	require.Equal(t, o{"step": float64(1)}, lines[1]["job"])
+
+	require.Equal(t, "outer", lines[2]["span"])
+	require.NotContains(t, lines[2], "parent_span_id")
+}
@@ -0,0 +1,112 @@
+package logctx
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+// What Handler does when there is no handler in the context and no default handler
+type NullHandlerMode int32
+
+const (
+	// Records are dropped, the handler isn't enabled for any level
+	NullDrop NullHandlerMode = iota
+
+	// Handler panics
+	NullPanic
+
+	// Records are dropped, a warning is written to stderr the first time each call site
+	// logs, and the call sites are counted, see VoidCallSites.  Useful for finding
+	// context plumbing bugs in production
+	NullWarn
+)
+
+// A call site that logged with no handler, see VoidCallSites
+type VoidCallSite struct {
+	Site  string // file:line, or "unknown" if the record had no source
+	Count int    // Number of records dropped
+}
+
+// Returns the call sites that logged with no handler while in NullWarn mode, most records first
+func (r *Registry) VoidCallSites() []VoidCallSite {
+	r.void.mu.Lock()
+	defer r.void.mu.Unlock()
+	sites := make([]VoidCallSite, 0, len(r.void.counts))
+	for s, c := range r.void.counts {
+		sites = append(sites, VoidCallSite{Site: s, Count: c})
+	}
+	slices.SortFunc(sites, func(a, b VoidCallSite) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Site, b.Site))
+	})
+	return sites
+}
+
+type voidSites struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// Returns the count including this record
+func (v *voidSites) add(site string) int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.counts == nil {
+		v.counts = map[string]int{}
+	}
+	v.counts[site]++
+	return v.counts[site]
+}
+
+// Used in NullWarn mode, enabled for every level so Handle sees the call sites
+type voidHandler struct {
+	sites *voidSites
+}
+
+func (h *voidHandler) Enabled(_ context.Context, _ slog.Level) bool {
+	return true
+}
+
+func (h *voidHandler) Handle(_ context.Context, r slog.Record) error {
+	site := "unknown"
+	if r.PC != 0 {
+		f, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		site = fmt.Sprintf("%s:%d", f.File, f.Line)
+	}
+	if h.sites.add(site) == 1 {
+		fmt.Fprintf(os.Stderr, "logctx: no handler in context, dropped record %+q at %s, see logctx.VoidCallSites for counts\n", r.Message, site)
+	}
+	return nil
+}
+
+func (h *voidHandler) WithAttrs(_ []slog.Attr) slog.Handler {
+	return h
+}
+
+func (h *voidHandler) WithGroup(_ string) slog.Handler {
+	return h
+}
+
+// Used in NullDrop mode, not enabled for any level so callers skip building records
+type dropHandler struct{}
+
+func (dropHandler) Enabled(_ context.Context, _ slog.Level) bool {
+	return false
+}
+
+func (dropHandler) Handle(_ context.Context, _ slog.Record) error {
+	return nil
+}
+
+func (h dropHandler) WithAttrs(_ []slog.Attr) slog.Handler {
+	return h
+}
+
+func (h dropHandler) WithGroup(_ string) slog.Handler {
+	return h
+}
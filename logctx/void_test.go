@@ -0,0 +1,90 @@
+package logctx_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/croepha/go-logging-extras/logctx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNullHandlerMode(t *testing.T) {
+	ctx := context.Background()
+	r := logctx.NewRegistry("void")
+
+	require.False(t, r.Handler(ctx).Enabled(ctx, 100), "drop mode shouldn't waste work")
+
+	prevStderr := os.Stderr
+	pr, pw, err := os.Pipe()
+	require.NoError(t, err)
+	os.Stderr = pw
+	defer func() { os.Stderr = prevStderr }()
+
+	r.SetNullHandlerMode(logctx.NullWarn)
+	_, file, line, _ := runtime.Caller(0)
+	for range 3 {
+		r.Info(ctx, "into the void")
+	}
+	r.Warn(ctx, "also into the void")
+
+	os.Stderr = prevStderr
+	require.NoError(t, pw.Close())
+	out, err := io.ReadAll(pr)
+	require.NoError(t, err)
+
+	site := file + ":" + strconv.Itoa(line+2)
+	require.Equal(t,
+		"logctx: no handler in context, dropped record \"into the void\" at "+site+", see logctx.VoidCallSites for counts\n"+
+			"logctx: no handler in context, dropped record \"also into the void\" at "+file+":"+strconv.Itoa(line+4)+", see logctx.VoidCallSites for counts\n",
+		string(out))
+	require.Equal(t, []logctx.VoidCallSite{
+		{Site: site, Count: 3},
+		{Site: file + ":" + strconv.Itoa(line+4), Count: 1},
+	}, r.VoidCallSites())
+
+	r.SetNullHandlerMode(logctx.NullPanic)
+	require.Panics(t, func() { r.Info(ctx, "panics") })
+}
+
+// The default registry has an early handler, the modes still apply
+func TestNullHandlerModeDefault(t *testing.T) {
+	ctx := context.Background()
+	defer logctx.Default().SetEarlyHandler(logctx.Default().EarlyHandler())
+	logctx.Default().SetEarlyHandler(logctx.NewEarlyHandler(10, time.Hour))
+	_, ok := logctx.Handler(ctx).(*logctx.EarlyHandler)
+	require.True(t, ok)
+
+	defer logctx.SetNullHandlerMode(logctx.NullDrop)
+	logctx.SetPanicOnNullHandler(true)
+	require.Panics(t, func() { logctx.Info(ctx, "panics") })
+
+	logctx.SetPanicOnNullHandler(false)
+	logctx.PanicOnNullHandler = true
+	require.Panics(t, func() { logctx.Info(ctx, "panics") })
+	logctx.PanicOnNullHandler = false
+
+	prevStderr := os.Stderr
+	pr, pw, err := os.Pipe()
+	require.NoError(t, err)
+	os.Stderr = pw
+	defer func() {
+		os.Stderr = prevStderr
+		_ = pw.Close()
+		_ = pr.Close()
+	}()
+
+	logctx.SetNullHandlerMode(logctx.NullWarn)
+	_, file, line, _ := runtime.Caller(0)
+	logctx.Info(ctx, "into the void")
+	// The default registry keeps its counts across runs, ie: -count=2
+	sites := []string{}
+	for _, s := range logctx.VoidCallSites() {
+		sites = append(sites, s.Site)
+	}
+	require.Contains(t, sites, file+":"+strconv.Itoa(line+1))
+}
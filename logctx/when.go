@@ -0,0 +1,164 @@
+package logctx
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+/*
+
+Conditional enablement of records based on the attributes carried by a handler chain
+
+WhenHandler should be installed as the base handler (see loginit), so that it sees
+every attribute added via Attr, lgsg.Sugar.Context or similar.  Records below the
+level of the wrapped handler are then enabled when the attributes match a rule.
+
+*/
+
+// Set of attribute values that must all be present for the rule to match
+// keys inside of groups are qualified with a "." like "job.tenant"
+type WhenRule map[string]string
+
+// Parses rules in the form of "tenant=acme,user_id=42"
+// All attributes in a rule must match, multiple rules can be separated with ";"
+func ParseWhenRules(s string) ([]WhenRule, error) {
+	var rules []WhenRule
+	for _, rs := range strings.Split(s, ";") {
+		if strings.TrimSpace(rs) == "" {
+			continue
+		}
+		rule := WhenRule{}
+		for _, kv := range strings.Split(rs, ",") {
+			k, v, ok := strings.Cut(kv, "=")
+			k = strings.TrimSpace(k)
+			if !ok || k == "" {
+				return nil, fmt.Errorf("when rule %+q: expected key=value", kv)
+			}
+			rule[k] = strings.TrimSpace(v)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Formats rules in the form accepted by ParseWhenRules
+func FormatWhenRules(rules []WhenRule) string {
+	rs := make([]string, len(rules))
+	for i, rule := range rules {
+		kvs := make([]string, 0, len(rule))
+		for _, k := range slices.Sorted(maps.Keys(rule)) {
+			kvs = append(kvs, k+"="+rule[k])
+		}
+		rs[i] = strings.Join(kvs, ",")
+	}
+	return strings.Join(rs, ";")
+}
+
+// Create a new handler instance
+// Records at or above level are enabled when the attributes added to the handler match
+// any of the rules, otherwise next decides
+func NewWhenHandler(next slog.Handler, level slog.Leveler) *WhenHandler {
+	return &WhenHandler{next: next, shared: &whenShared{level: level}}
+}
+
+type WhenHandler struct {
+	next   slog.Handler
+	shared *whenShared
+	groups string
+	attrs  *whenAttr
+}
+
+type whenShared struct {
+	level slog.Leveler
+	rules atomic.Pointer[[]WhenRule]
+}
+
+// Immutable list of attributes seen so far, most recent first
+type whenAttr struct {
+	key    string
+	value  slog.Value
+	parent *whenAttr
+}
+
+// Replaces the rules, safe to call at runtime, affects all handlers derived from this one
+func (h *WhenHandler) SetRules(rules []WhenRule) {
+	h.shared.rules.Store(&rules)
+}
+
+// Returns the current rules
+func (h *WhenHandler) Rules() []WhenRule {
+	if r := h.shared.rules.Load(); r != nil {
+		return *r
+	}
+	return nil
+}
+
+func (h *WhenHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	if h.next.Enabled(ctx, l) {
+		return true
+	}
+	if l < h.shared.level.Level() {
+		return false
+	}
+	for _, rule := range h.Rules() {
+		if h.matches(rule) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *WhenHandler) matches(rule WhenRule) bool {
+	for k, v := range rule {
+		found := false
+		for a := h.attrs; a != nil; a = a.parent {
+			if a.key == k {
+				found = a.value.String() == v
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (h *WhenHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.next.Handle(ctx, r)
+}
+
+func (h *WhenHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	r := *h
+	r.next = h.next.WithAttrs(attrs)
+	r.attrs = appendWhenAttrs(r.attrs, h.groups, attrs)
+	return &r
+}
+
+func appendWhenAttrs(list *whenAttr, prefix string, attrs []slog.Attr) *whenAttr {
+	for _, a := range attrs {
+		v := a.Value.Resolve()
+		if v.Kind() == slog.KindGroup {
+			p := prefix
+			if a.Key != "" {
+				p += a.Key + "."
+			}
+			list = appendWhenAttrs(list, p, v.Group())
+			continue
+		}
+		list = &whenAttr{key: prefix + a.Key, value: v, parent: list}
+	}
+	return list
+}
+
+func (h *WhenHandler) WithGroup(name string) slog.Handler {
+	r := *h
+	r.next = h.next.WithGroup(name)
+	r.groups = h.groups + name + "."
+	return &r
+}
@@ -0,0 +1,47 @@
+package logctx_test
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/croepha/go-logging-extras/logctx"
+	"github.com/croepha/go-logging-extras/logtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWhenHandler(t *testing.T) {
+	th := logtest.NewTestHandler(t)
+
+	rules, err := logctx.ParseWhenRules("tenant=acme,user_id=42;job.name=cleanup")
+	require.NoError(t, err)
+	require.Equal(t, []logctx.WhenRule{{"tenant": "acme", "user_id": "42"}, {"job.name": "cleanup"}}, rules)
+	require.Equal(t, "tenant=acme,user_id=42;job.name=cleanup", logctx.FormatWhenRules(rules))
+
+	_, err = logctx.ParseWhenRules("tenant")
+	require.Error(t, err)
+
+	wh := logctx.NewWhenHandler(th.H, slog.LevelDebug)
+	wh.SetRules(rules)
+
+	ctx := logctx.Context(context.Background(), wh)
+	ctx = logctx.Attr(ctx, "tenant", "acme")
+
+	logctx.Debug(ctx, "not logged")
+	th.RequireEOF()
+
+	matched := logctx.Attr(ctx, "user_id", 42)
+	logctx.Debug(matched, "debug test")
+	th.RequireLine(slog.LevelDebug, "debug test", "tenant", "acme", "user_id", 42)
+
+	logctx.Debug(logctx.Attr(matched, "user_id", 43), "not logged")
+	th.RequireEOF()
+
+	grouped := logctx.Context(ctx, logctx.Handler(ctx).WithAttrs([]slog.Attr{slog.Group("job", "name", "cleanup")}))
+	logctx.Debug(grouped, "debug test")
+	th.RequireLine(slog.LevelDebug, "debug test", "tenant", "acme", "job", map[string]any{"name": "cleanup"})
+
+	wh.SetRules(nil)
+	logctx.Debug(matched, "not logged")
+	th.RequireEOF()
+}
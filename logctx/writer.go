@@ -0,0 +1,61 @@
+package logctx
+
+import (
+	"context"
+	"io"
+	"log"
+	"log/slog"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// Returns a writer that logs each line written to it as a record at level with the handler from ctx,
+// ie: for exec.Cmd.Stderr.  Lines longer than 64KiB are split, Close logs a final line that
+// doesn't end with a newline.  The source is the caller of Write, skipping the standard library
+// packages that wrap writers, like log and fmt
+func Writer(ctx context.Context, level slog.Level) io.WriteCloser {
+	return &lineWriter{emit: func(line string) {
+		logLine(ctx, line, level, callerPC(), false)
+	}}
+}
+
+// Returns a *log.Logger that logs each line as a record at level with the handler from ctx,
+// ie: for http.Server.ErrorLog.  The source is the caller of the logger's methods
+func StdLogger(ctx context.Context, level slog.Level) *log.Logger {
+	return log.New(Writer(ctx, level), "", 0)
+}
+
+// Packages skipped when resolving the caller of Writer
+var writerPackages = []string{"runtime", "log", "fmt", "io", "bufio", "os", "internal/poll", thisPackage()}
+
+func thisPackage() string {
+	var pcs [1]uintptr
+	runtime.Callers(1, pcs[:])
+	f, _ := runtime.CallersFrames(pcs[:]).Next()
+	return funcPackage(f.Function)
+}
+
+// ie: "github.com/a/b.(*T).M" is in "github.com/a/b"
+func funcPackage(fn string) string {
+	i := strings.LastIndex(fn, "/") + 1
+	if j := strings.Index(fn[i:], "."); j >= 0 {
+		return fn[:i+j]
+	}
+	return fn
+}
+
+func callerPC() uintptr {
+	var pcs [32]uintptr
+	n := runtime.Callers(2, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		f, more := frames.Next()
+		if !slices.Contains(writerPackages, funcPackage(f.Function)) {
+			return f.PC + 1 // Like the return addresses from runtime.Callers, which Record.PC expects
+		}
+		if !more {
+			return 0
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package logctx_test
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"github.com/croepha/go-logging-extras/logctx"
+	"github.com/croepha/go-logging-extras/logtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriter(t *testing.T) {
+	th := logtest.NewTestHandler(t)
+	ctx := logctx.Attr(logctx.Context(context.Background(), th.H), "attr0", "foo")
+
+	w := logctx.Writer(ctx, slog.LevelWarn)
+	fmt.Fprint(w, "partial ")
+	th.RequireEOF()
+	fmt.Fprint(w, "line\nsecond\r\nlast")
+	th.RequireLineExtra(-1, 0, slog.LevelWarn, "partial line", "attr0", "foo")
+	th.RequireLineExtra(-2, 0, slog.LevelWarn, "second", "attr0", "foo")
+	th.RequireEOF()
+	require.NoError(t, w.Close())
+	th.RequireLine(slog.LevelWarn, "last", "attr0", "foo")
+
+	l := logctx.StdLogger(ctx, slog.LevelError)
+	l.Printf("std %d", 1)
+	th.RequireLine(slog.LevelError, "std 1", "attr0", "foo")
+
+	logctx.StdLogger(ctx, slog.LevelDebug).Print("not logged")
+	th.RequireEOF()
+}
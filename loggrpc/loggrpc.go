@@ -0,0 +1,222 @@
+package loggrpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/croepha/go-logging-extras/errordump"
+	"github.com/croepha/go-logging-extras/internal"
+	"github.com/croepha/go-logging-extras/logctx"
+	"github.com/croepha/go-logging-extras/logwrap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+/*
+
+gRPC interceptors for request scoped logging
+
+The server interceptors give every call a context with a handler that has the call
+attributes added, and log one record per call on completion.  The client interceptors
+propagate the request ID from the context to the server and log completed calls.
+
+*/
+
+// Options for the interceptors, the zero value is valid
+type Options struct {
+	// Metadata key the request ID is read from and sent in, defaults to x-request-id
+	RequestIDKey string
+
+	// Generates request IDs for calls that don't have a valid one, defaults to 16 random hex chars
+	NewRequestID func() string
+}
+
+func (o *Options) requestIDKey() string {
+	if o == nil || o.RequestIDKey == "" {
+		return "x-request-id"
+	}
+	return o.RequestIDKey
+}
+
+func (o *Options) newRequestID() string {
+	if o != nil && o.NewRequestID != nil {
+		return o.NewRequestID()
+	}
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Adds request_id, grpc_method and peer attributes to the context
+// the incoming request ID is replaced if it's missing or invalid
+func (o *Options) serverContext(ctx context.Context, method string) context.Context {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(o.requestIDKey()); len(v) > 0 {
+			id = v[0]
+		}
+	}
+	if !internal.ValidRequestID(id) {
+		id = o.newRequestID()
+	}
+	ctx = logctx.WithRequestID(ctx, id)
+
+	attrs := []slog.Attr{slog.String("grpc_method", method)}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		attrs = append(attrs, slog.String("peer", p.Addr.String()))
+	}
+	return logctx.WithAttrs(ctx, attrs...)
+}
+
+// Adds the request ID from ctx to the outgoing metadata, unless it's already there
+func (o *Options) clientContext(ctx context.Context) context.Context {
+	id := logctx.RequestID(ctx)
+	if id == "" {
+		return ctx
+	}
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get(o.requestIDKey())) > 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, o.requestIDKey(), id)
+}
+
+// Level used for the completion record of a call with the given code
+func codeLevel(code codes.Code) slog.Level {
+	switch code {
+	case codes.OK:
+		return slog.LevelInfo
+	case codes.Canceled, codes.InvalidArgument, codes.NotFound, codes.AlreadyExists,
+		codes.PermissionDenied, codes.Unauthenticated, codes.FailedPrecondition,
+		codes.OutOfRange, codes.ResourceExhausted, codes.Aborted:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
+
+// Logs the completion record for a call
+// method is only added if not empty, server contexts already have grpc_method
+// errors are added with errordump and the status proto, including its details, is added as "status"
+func logCall(ctx context.Context, msg string, method string, start time.Time, err error) {
+	s, _ := status.FromError(err)
+	attrs := []slog.Attr{
+		slog.String("code", s.Code().String()),
+		slog.Duration("duration", time.Since(start)),
+	}
+	if method != "" {
+		attrs = append(attrs, slog.String("grpc_method", method))
+	}
+	if err != nil {
+		attrs = append(attrs,
+			errordump.NewSlog("error", err),
+			slog.Any("status", s.Proto()),
+		)
+	}
+	logwrap.LogAttrs(ctx, logctx.Handler(ctx), logwrap.WrapDepth__DisablePC, codeLevel(s.Code()), attrs, msg)
+}
+
+// Returns a server interceptor that sets up the call context and logs a "grpc call" record on completion
+// opts may be nil
+func UnaryServerInterceptor(opts *Options) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		ctx = opts.serverContext(ctx, info.FullMethod)
+		resp, err := handler(ctx, req)
+		logCall(ctx, "grpc call", "", start, err)
+		return resp, err
+	}
+}
+
+// Returns a server interceptor that sets up the stream context and logs a "grpc call" record on completion
+// opts may be nil
+func StreamServerInterceptor(opts *Options) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		ctx := opts.serverContext(ss.Context(), info.FullMethod)
+		err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		logCall(ctx, "grpc call", "", start, err)
+		return err
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// Returns a client interceptor that propagates the request ID and logs a "grpc client call" record on completion
+// opts may be nil
+func UnaryClientInterceptor(opts *Options) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(opts.clientContext(ctx), method, req, reply, cc, callOpts...)
+		logCall(ctx, "grpc client call", method, start, err)
+		return err
+	}
+}
+
+// Returns a client interceptor that propagates the request ID and logs a "grpc client call" record
+// when the stream ends
+// opts may be nil
+func StreamClientInterceptor(opts *Options) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		cs, err := streamer(opts.clientContext(ctx), desc, cc, method, callOpts...)
+		if err != nil {
+			logCall(ctx, "grpc client call", method, start, err)
+			return nil, err
+		}
+		s := &clientStream{ClientStream: cs, ctx: ctx, method: method, start: start, serverStreams: desc.ServerStreams}
+		go s.watch()
+		return s, nil
+	}
+}
+
+type clientStream struct {
+	grpc.ClientStream
+	ctx           context.Context
+	method        string
+	start         time.Time
+	serverStreams bool
+	once          sync.Once
+}
+
+// Logs streams that are abandoned by canceling the context, instead of being read until the end
+func (s *clientStream) watch() {
+	<-s.ClientStream.Context().Done() // Also done when the stream ends normally
+	if err := s.ctx.Err(); err != nil {
+		s.finish(status.FromContextError(err).Err())
+	}
+}
+
+func (s *clientStream) finish(err error) {
+	s.once.Do(func() {
+		logCall(s.ctx, "grpc client call", s.method, s.start, err)
+	})
+}
+
+func (s *clientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case errors.Is(err, io.EOF):
+		s.finish(nil)
+	case err != nil:
+		s.finish(err)
+	case !s.serverStreams:
+		s.finish(nil) // Client streams get a single response, ie: CloseAndRecv
+	}
+	return err
+}
@@ -0,0 +1,180 @@
+package loggrpc_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/croepha/go-logging-extras/logctx"
+	"github.com/croepha/go-logging-extras/loggrpc"
+	"github.com/croepha/go-logging-extras/logtest"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type o = map[string]any
+
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *lockedBuffer) lines(t *testing.T) []o {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return logtest.JSONLines(t, &b.buf)
+}
+
+func Test(t *testing.T) {
+	serverLog, clientLog := &lockedBuffer{}, &lockedBuffer{}
+
+	defer logctx.SetDefaultHandler(logctx.Default().DefaultHandler())
+	logctx.SetDefaultHandler(slog.NewJSONHandler(serverLog, nil))
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(loggrpc.UnaryServerInterceptor(nil)),
+		grpc.StreamInterceptor(loggrpc.StreamServerInterceptor(nil)),
+		grpc.UnknownServiceHandler(func(_ any, stream grpc.ServerStream) error {
+			switch method, _ := grpc.MethodFromServerStream(stream); method {
+			case "/test.Test/Upload":
+				n := 0
+				for stream.RecvMsg(&wrapperspb.StringValue{}) == nil {
+					n++
+				}
+				return stream.SendMsg(wrapperspb.Int64(int64(n)))
+			case "/test.Test/Hang":
+				<-stream.Context().Done()
+				return stream.Context().Err()
+			}
+			logctx.Info(stream.Context(), "streaming")
+			if err := stream.SendMsg(wrapperspb.String(logctx.RequestID(stream.Context()))); err != nil {
+				return err
+			}
+			s, err := status.New(codes.Internal, "broken").WithDetails(wrapperspb.String("detail"))
+			require.NoError(t, err)
+			return s.Err()
+		}),
+	)
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go func() { _ = srv.Serve(lis) }()
+	defer srv.Stop()
+
+	cc, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(loggrpc.UnaryClientInterceptor(nil)),
+		grpc.WithStreamInterceptor(loggrpc.StreamClientInterceptor(nil)),
+	)
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx := logctx.Context(context.Background(), slog.NewJSONHandler(clientLog, nil))
+	ctx = logctx.WithRequestID(ctx, "req-1")
+
+	_, err = healthpb.NewHealthClient(cc).Check(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+
+	require.Equal(t, 1, strings.Count(serverLog.String(), `"grpc_method":`))
+	lines := serverLog.lines(t)
+	require.Len(t, lines, 1)
+	require.Equal(t, "grpc call", lines[0]["msg"])
+	require.Equal(t, "INFO", lines[0]["level"])
+	require.Equal(t, "req-1", lines[0]["request_id"])
+	require.Equal(t, "/grpc.health.v1.Health/Check", lines[0]["grpc_method"])
+	require.Equal(t, "OK", lines[0]["code"])
+	require.Equal(t, "bufconn", lines[0]["peer"])
+
+	require.Equal(t, 1, strings.Count(clientLog.String(), `"grpc_method":`))
+	lines = clientLog.lines(t)
+	require.Len(t, lines, 1)
+	require.Equal(t, "grpc client call", lines[0]["msg"])
+	require.Equal(t, "OK", lines[0]["code"])
+
+	// Invalid incoming request IDs are replaced
+	badCtx := metadata.AppendToOutgoingContext(ctx, "x-request-id", "req 1 fake=record")
+	_, err = healthpb.NewHealthClient(cc).Check(badCtx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+
+	lines = serverLog.lines(t)
+	require.Len(t, lines, 1)
+	require.Len(t, lines[0]["request_id"], 16)
+	clientLog.lines(t)
+
+	cs, err := cc.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, "/test.Test/Stream")
+	require.NoError(t, err)
+	require.NoError(t, cs.CloseSend())
+	msg := &wrapperspb.StringValue{}
+	require.NoError(t, cs.RecvMsg(msg))
+	require.Equal(t, "req-1", msg.Value)
+	require.Equal(t, codes.Internal, status.Code(cs.RecvMsg(msg)))
+
+	lines = serverLog.lines(t)
+	require.Len(t, lines, 2)
+	require.Equal(t, "streaming", lines[0]["msg"])
+	require.Equal(t, "req-1", lines[0]["request_id"])
+	require.Equal(t, "grpc call", lines[1]["msg"])
+	require.Equal(t, "ERROR", lines[1]["level"])
+	require.Equal(t, "Internal", lines[1]["code"])
+	require.Equal(t, "rpc error: code = Internal desc = broken", lines[1]["error"].(o)["String"])
+	require.Len(t, lines[1]["status"].(o)["details"], 1)
+
+	lines = clientLog.lines(t)
+	require.Len(t, lines, 1)
+	require.Equal(t, "grpc client call", lines[0]["msg"])
+	require.Equal(t, "Internal", lines[0]["code"])
+
+	// Client streaming, ends with a single successful RecvMsg
+	cs, err = cc.NewStream(ctx, &grpc.StreamDesc{ClientStreams: true}, "/test.Test/Upload")
+	require.NoError(t, err)
+	require.NoError(t, cs.SendMsg(wrapperspb.String("a")))
+	require.NoError(t, cs.SendMsg(wrapperspb.String("b")))
+	require.NoError(t, cs.CloseSend())
+	count := &wrapperspb.Int64Value{}
+	require.NoError(t, cs.RecvMsg(count))
+	require.Equal(t, int64(2), count.Value)
+
+	lines = clientLog.lines(t)
+	require.Len(t, lines, 1)
+	require.Equal(t, "grpc client call", lines[0]["msg"])
+	require.Equal(t, "/test.Test/Upload", lines[0]["grpc_method"])
+	require.Equal(t, "OK", lines[0]["code"])
+
+	// Abandoned by canceling the context
+	hangCtx, cancel := context.WithCancel(ctx)
+	_, err = cc.NewStream(hangCtx, &grpc.StreamDesc{ServerStreams: true}, "/test.Test/Hang")
+	require.NoError(t, err)
+	cancel()
+	require.Eventually(t, func() bool {
+		lines = clientLog.lines(t)
+		return len(lines) > 0
+	}, time.Second, time.Millisecond)
+	require.Len(t, lines, 1)
+	require.Equal(t, "/test.Test/Hang", lines[0]["grpc_method"])
+	require.Equal(t, "Canceled", lines[0]["code"])
+}
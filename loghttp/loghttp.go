@@ -0,0 +1,198 @@
+package loghttp
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/croepha/go-logging-extras/errordump"
+	"github.com/croepha/go-logging-extras/internal"
+	"github.com/croepha/go-logging-extras/logctx"
+	"github.com/croepha/go-logging-extras/logwrap"
+)
+
+/*
+
+HTTP server helpers for request scoped logging
+
+Middleware gives every request a context with a handler that has the request
+attributes added, so that anything logged via logctx/lgsg/ctxhandler while serving
+the request includes them.  It also logs one access record per request.
+
+*/
+
+// Options for Middleware, the zero value is valid
+type Options struct {
+	// Header the request ID is read from, defaults to X-Request-ID
+	RequestIDHeader string
+
+	// If set, the request ID is also set as a response header
+	EchoRequestID bool
+
+	// Generates request IDs for requests that don't have one, defaults to 16 random hex chars
+	NewRequestID func() string
+}
+
+func (o *Options) requestIDHeader() string {
+	if o.RequestIDHeader == "" {
+		return "X-Request-ID"
+	}
+	return o.RequestIDHeader
+}
+
+func newRequestID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Wraps next so that each request gets a logging context and an access record
+// opts may be nil
+//
+// The context has these attributes:
+//   - request_id: from the request ID header, or generated if missing or invalid
+//   - method, remote_addr
+//   - route: http.Request.Pattern, only if routing has already happened
+//   - trace_id, trace_parent: from a W3C traceparent header, if present
+//
+// On completion an "http request" record is logged with status, bytes, duration and route
+// (unless the context already has it), at Error level for 5xx statuses and panics.
+// Panics are logged with errordump and re-panicked.
+func Middleware(next http.Handler, opts *Options) http.Handler {
+	if opts == nil {
+		opts = &Options{}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(opts.requestIDHeader())
+		if !internal.ValidRequestID(id) {
+			if opts.NewRequestID != nil {
+				id = opts.NewRequestID()
+			} else {
+				id = newRequestID()
+			}
+		}
+		if opts.EchoRequestID {
+			w.Header().Set(opts.requestIDHeader(), id)
+		}
+
+		ctx := logctx.WithRequestID(r.Context(), id)
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("remote_addr", r.RemoteAddr),
+		}
+		routed := r.Pattern != ""
+		if routed {
+			attrs = append(attrs, slog.String("route", r.Pattern))
+		}
+		attrs = append(attrs, TraceAttrs(r.Header)...)
+		ctx = logctx.WithAttrs(ctx, attrs...)
+
+		r = r.WithContext(ctx)
+		rw := &responseWriter{ResponseWriter: w}
+
+		defer func() {
+			p := recover()
+
+			status := rw.status
+			if status == 0 && p == nil {
+				status = http.StatusOK
+			}
+
+			level := slog.LevelInfo
+			if status >= 500 || p != nil {
+				level = slog.LevelError
+			}
+
+			attrs := []slog.Attr{
+				slog.Int("status", status),
+				slog.Int64("bytes", rw.bytes),
+				slog.Duration("duration", time.Since(start)),
+			}
+			if !routed {
+				// ServeMux sets this on our copy of the request
+				attrs = append(attrs, slog.String("route", r.Pattern))
+			}
+			if p != nil {
+				err, ok := p.(error)
+				if !ok {
+					err = fmt.Errorf("%v", p)
+				}
+				attrs = append(attrs, errordump.NewSlog("panic", err))
+			}
+
+			logwrap.LogAttrs(ctx, logctx.Handler(ctx), logwrap.WrapDepth__DisablePC, level, attrs, "http request")
+
+			if p != nil {
+				panic(p)
+			}
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// Returns trace_id and trace_parent attributes from a W3C traceparent header
+// returns nil if the header is missing or malformed
+func TraceAttrs(h http.Header) []slog.Attr {
+	// version-traceid-parentid-flags
+	parts := strings.Split(h.Get("traceparent"), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return nil
+	}
+	return []slog.Attr{
+		slog.String("trace_id", parts[1]),
+		slog.String("trace_parent", parts[2]),
+	}
+}
+
+// Records status and size of the response
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.status == 0 && code >= 200 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Allows http.ResponseController to reach the original ResponseWriter
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// For libraries that type assert http.Hijacker, ie: websocket upgraders
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil && w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+func (w *responseWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
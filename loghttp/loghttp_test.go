@@ -0,0 +1,216 @@
+package loghttp_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/croepha/go-logging-extras/logctx"
+	"github.com/croepha/go-logging-extras/loghttp"
+	"github.com/croepha/go-logging-extras/logtest"
+	"github.com/stretchr/testify/require"
+)
+
+type o = map[string]any
+
+func TestMiddleware(t *testing.T) {
+	buf := bytes.Buffer{}
+	ctx := logctx.Context(context.Background(), slog.NewJSONHandler(&buf, nil))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		logctx.Info(r.Context(), "handling")
+		_, _ = w.Write([]byte("hello"))
+	})
+	mux.HandleFunc("GET /panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	})
+	h := loghttp.Middleware(mux, &loghttp.Options{EchoRequestID: true})
+
+	req := httptest.NewRequestWithContext(ctx, "GET", "/users/10", nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	req.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, "req-1", rec.Header().Get("X-Request-ID"))
+
+	lines := logtest.JSONLines(t, &buf)
+	require.Len(t, lines, 2)
+	common := o{
+		"request_id":   "req-1",
+		"method":       "GET",
+		"remote_addr":  "192.0.2.1:1234",
+		"trace_id":     "0af7651916cd43dd8448eb211c80319c",
+		"trace_parent": "b7ad6b7169203331",
+	}
+	for k, v := range common {
+		require.Equal(t, v, lines[0][k], k)
+		require.Equal(t, v, lines[1][k], k)
+	}
+	require.Equal(t, "handling", lines[0]["msg"])
+	require.Equal(t, "http request", lines[1]["msg"])
+	require.Equal(t, "INFO", lines[1]["level"])
+	require.Equal(t, "GET /users/{id}", lines[1]["route"])
+	require.Equal(t, float64(200), lines[1]["status"])
+	require.Equal(t, float64(5), lines[1]["bytes"])
+	require.Contains(t, lines[1], "duration")
+
+	req = httptest.NewRequestWithContext(ctx, "GET", "/panic", nil)
+	require.Panics(t, func() { h.ServeHTTP(httptest.NewRecorder(), req) })
+
+	lines = logtest.JSONLines(t, &buf)
+	require.Len(t, lines, 1)
+	require.Equal(t, "ERROR", lines[0]["level"])
+	require.Equal(t, "GET /panic", lines[0]["route"])
+	require.Len(t, lines[0]["request_id"], 16)
+	require.Equal(t, "oops", lines[0]["panic"].(o)["String"])
+}
+
+func TestMiddlewareRouted(t *testing.T) {
+	buf := bytes.Buffer{}
+	ctx := logctx.Context(context.Background(), slog.NewJSONHandler(&buf, nil))
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /users/{id}", loghttp.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logctx.Info(r.Context(), "handling")
+	}), nil))
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequestWithContext(ctx, "GET", "/users/10", nil))
+
+	raw := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, raw, 2)
+	for _, l := range raw {
+		require.Equal(t, 1, strings.Count(l, `"route":`), l)
+	}
+	lines := logtest.JSONLines(t, &buf)
+	require.Equal(t, "GET /users/{id}", lines[0]["route"])
+	require.Equal(t, "GET /users/{id}", lines[1]["route"])
+}
+
+func TestMiddlewareRequestID(t *testing.T) {
+	buf := bytes.Buffer{}
+	ctx := logctx.Context(context.Background(), slog.NewJSONHandler(&buf, nil))
+	h := loghttp.Middleware(http.NotFoundHandler(), &loghttp.Options{EchoRequestID: true})
+
+	for id, valid := range map[string]bool{
+		"req-1":                  true,
+		"a.b_c:d-0":              true,
+		strings.Repeat("a", 128): true,
+		strings.Repeat("a", 129): false,
+		"req 1":                  false,
+		"req\nfake=record":       false,
+		"req-\u00e9":             false,
+	} {
+		req := httptest.NewRequestWithContext(ctx, "GET", "/", nil)
+		req.Header.Set("X-Request-ID", id)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		lines := logtest.JSONLines(t, &buf)
+		require.Len(t, lines, 1)
+		if valid {
+			require.Equal(t, id, rec.Header().Get("X-Request-ID"))
+			require.Equal(t, id, lines[0]["request_id"])
+		} else {
+			require.Len(t, rec.Header().Get("X-Request-ID"), 16, id)
+			require.Equal(t, rec.Header().Get("X-Request-ID"), lines[0]["request_id"])
+		}
+	}
+}
+
+func TestMiddlewareHijack(t *testing.T) {
+	buf := bytes.Buffer{}
+	h := loghttp.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		require.NoError(t, err)
+		defer conn.Close()
+		_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n\r\nhijacked")
+		require.NoError(t, rw.Flush())
+	}), nil)
+	done := make(chan struct{})
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		h.ServeHTTP(w, r)
+	}))
+	srv.Config.BaseContext = func(net.Listener) context.Context {
+		return logctx.Context(context.Background(), slog.NewJSONHandler(&buf, nil))
+	}
+	srv.Start()
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: test\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(string(resp), "\r\n\r\nhijacked"))
+
+	<-done // Close doesn't wait for hijacked connections
+	lines := logtest.JSONLines(t, &buf)
+	require.Len(t, lines, 1)
+	require.Equal(t, float64(101), lines[0]["status"])
+}
+
+func TestTransport(t *testing.T) {
+	buf := bytes.Buffer{}
+	ctx := logctx.Context(context.Background(), slog.NewJSONHandler(&buf, nil))
+	ctx = logctx.WithRequestID(ctx, "req-1")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("X-Request-ID") + " " + r.Header.Get("X-Tenant")))
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: loghttp.NewTransport(nil, &loghttp.TransportOptions{
+		Trace: true,
+		Propagate: func(ctx context.Context, h http.Header) {
+			h.Set("X-Tenant", "acme")
+		},
+	})}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", srv.URL+"/path?token=secret", nil)
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, "req-1 acme", string(body))
+	require.Empty(t, req.Header.Get("X-Request-ID"))
+
+	lines := logtest.JSONLines(t, &buf)
+	require.Len(t, lines, 1)
+	require.Equal(t, "http client request", lines[0]["msg"])
+	require.Equal(t, "INFO", lines[0]["level"])
+	require.Equal(t, "req-1", lines[0]["request_id"])
+	require.Equal(t, srv.URL+"/path?token=xxxxx", lines[0]["url"])
+	require.Equal(t, float64(200), lines[0]["status"])
+	require.Equal(t, float64(0), lines[0]["retries"])
+	require.Contains(t, lines[0]["timings"], "first_byte")
+
+	srv.Close()
+	_, err = client.Get(srv.URL)
+	require.Error(t, err)
+
+	lines = logtest.JSONLines(t, &buf)
+	require.Len(t, lines, 0) // no handler in the context of client.Get
+
+	req, err = http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+	require.NoError(t, err)
+	_, err = client.Do(req)
+	require.Error(t, err)
+
+	lines = logtest.JSONLines(t, &buf)
+	require.Len(t, lines, 1)
+	require.Equal(t, "ERROR", lines[0]["level"])
+	require.Equal(t, "OpError", lines[0]["error"].(o)["Error"].(o)["ReflectedName"])
+	require.Equal(t, "dial", lines[0]["error"].(o)["Error"].(o)["NextDetails"].(o)["Op"])
+}
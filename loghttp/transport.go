@@ -0,0 +1,172 @@
+package loghttp
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/croepha/go-logging-extras/errordump"
+	"github.com/croepha/go-logging-extras/logctx"
+	"github.com/croepha/go-logging-extras/logwrap"
+)
+
+// Options for NewTransport, the zero value is valid
+type TransportOptions struct {
+	// Header the request ID from the context is sent in, defaults to X-Request-ID
+	RequestIDHeader string
+
+	// Called for every outgoing request to propagate more context values as headers
+	Propagate func(ctx context.Context, h http.Header)
+
+	// If set, httptrace timings (dns, connect, tls, got_conn, first_byte) are added as a "timings" group
+	Trace bool
+}
+
+// Returns a RoundTripper that logs an "http client request" record for every request using the
+// handler from the request's context.  The record has method, host, redacted url, status, duration
+// and the number of retries done by the underlying transport, errors are added with errordump.
+// The request ID from the context is sent as a header.
+// base defaults to http.DefaultTransport, opts may be nil
+func NewTransport(base http.RoundTripper, opts *TransportOptions) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if opts == nil {
+		opts = &TransportOptions{}
+	}
+	return &transport{base: base, opts: opts}
+}
+
+type transport struct {
+	base http.RoundTripper
+	opts *TransportOptions
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	ctx := req.Context()
+
+	header := t.opts.RequestIDHeader
+	if header == "" {
+		header = "X-Request-ID"
+	}
+	id := logctx.RequestID(ctx)
+	if (id != "" && req.Header.Get(header) == "") || t.opts.Propagate != nil {
+		// RoundTrippers must not modify the given request
+		req = req.Clone(ctx)
+		if id != "" && req.Header.Get(header) == "" {
+			req.Header.Set(header, id)
+		}
+		if t.opts.Propagate != nil {
+			t.opts.Propagate(ctx, req.Header)
+		}
+	}
+
+	tt := &traceTimings{start: start}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), tt.clientTrace(t.opts.Trace)))
+
+	resp, err := t.base.RoundTrip(req)
+
+	attrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("host", req.URL.Host),
+		slog.String("url", redactURL(req.URL)),
+	}
+	level := slog.LevelInfo
+	if err != nil {
+		level = slog.LevelError
+		attrs = append(attrs, errordump.NewSlog("error", err))
+	} else {
+		if resp.StatusCode >= 500 {
+			level = slog.LevelWarn
+		}
+		attrs = append(attrs, slog.Int("status", resp.StatusCode))
+	}
+	attrs = append(attrs, slog.Duration("duration", time.Since(start)))
+	attrs = append(attrs, tt.attrs(t.opts.Trace)...)
+
+	logwrap.LogAttrs(ctx, logctx.Handler(ctx), logwrap.WrapDepth__DisablePC, level, attrs, "http client request")
+
+	return resp, err
+}
+
+// Returns the URL with the password and query values replaced with "xxxxx"
+func redactURL(u *url.URL) string {
+	if u.RawQuery != "" {
+		q := u.Query()
+		for k, vs := range q {
+			for i := range vs {
+				vs[i] = "xxxxx"
+			}
+			q[k] = vs
+		}
+		c := *u
+		c.RawQuery = q.Encode()
+		u = &c
+	}
+	return u.Redacted()
+}
+
+type traceTimings struct {
+	mu                                    sync.Mutex
+	start                                 time.Time
+	conns                                 int
+	dns, connect, tls, gotConn, firstByte time.Duration
+}
+
+func (tt *traceTimings) since() time.Duration { return time.Since(tt.start) }
+
+func (tt *traceTimings) set(d *time.Duration) {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	*d = tt.since()
+}
+
+func (tt *traceTimings) clientTrace(timings bool) *httptrace.ClientTrace {
+	ct := &httptrace.ClientTrace{
+		// The transport gets a new connection for each attempt
+		GetConn: func(string) {
+			tt.mu.Lock()
+			defer tt.mu.Unlock()
+			tt.conns++
+		},
+	}
+	if timings {
+		ct.DNSDone = func(httptrace.DNSDoneInfo) { tt.set(&tt.dns) }
+		ct.ConnectDone = func(string, string, error) { tt.set(&tt.connect) }
+		ct.TLSHandshakeDone = func(tls.ConnectionState, error) { tt.set(&tt.tls) }
+		ct.GotConn = func(httptrace.GotConnInfo) { tt.set(&tt.gotConn) }
+		ct.GotFirstResponseByte = func() { tt.set(&tt.firstByte) }
+	}
+	return ct
+}
+
+func (tt *traceTimings) attrs(timings bool) []slog.Attr {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	attrs := []slog.Attr{slog.Int("retries", max(tt.conns-1, 0))}
+	if timings {
+		var t []any
+		for _, d := range []struct {
+			name string
+			d    time.Duration
+		}{
+			{"dns", tt.dns},
+			{"connect", tt.connect},
+			{"tls", tt.tls},
+			{"got_conn", tt.gotConn},
+			{"first_byte", tt.firstByte},
+		} {
+			if d.d != 0 {
+				t = append(t, slog.Duration(d.name, d.d))
+			}
+		}
+		attrs = append(attrs, slog.Group("timings", t...))
+	}
+	return attrs
+}
@@ -0,0 +1,91 @@
+package loginit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/croepha/go-logging-extras/logctx"
+)
+
+// Settings passed to child processes, see ChildEnv
+var childSettings = []string{"SLOG_LEVEL", "SLOG_OUTPUT", "SLOG_DEBUG_WHEN", "SLOG_NULL_HANDLER", "SLOG_TRACE", "SLOG_PPROF_LABELS"}
+
+// Returns environment variables for a child process that uses Init, so that its records are
+// logged with the same settings and carry the parent's context attributes and a parent_pid attribute
+// keys selects the context attributes (see logctx.Attrs) to pass, defaults to request_id
+//
+//	cmd.Env = append(os.Environ(), loginit.ChildEnv(ctx)...)
+func ChildEnv(ctx context.Context, keys ...string) []string {
+	if len(keys) == 0 {
+		keys = []string{logctx.RequestIDKey.Name()}
+	}
+
+	var env []string
+	for _, k := range childSettings {
+		v, ok := os.LookupEnv(k)
+		if wh := debugWhen.Load(); k == "SLOG_DEBUG_WHEN" && wh != nil {
+			v, ok = logctx.FormatWhenRules(wh.Rules()), true // May have been changed with SetDebugWhen
+		}
+		if ok {
+			env = append(env, k+"="+v)
+		}
+	}
+
+	attrs := map[string]any{}
+	for _, a := range logctx.Attrs(ctx) {
+		if slices.Contains(keys, a.Key) {
+			attrs[a.Key] = a.Value.Resolve().Any()
+		}
+	}
+	if len(attrs) > 0 {
+		if b, err := json.Marshal(attrs); err == nil {
+			env = append(env, "SLOG_CONTEXT_ATTRS="+string(b))
+		}
+	}
+
+	return append(env, "SLOG_PARENT_PID="+strconv.Itoa(os.Getpid()))
+}
+
+// Reads back the attributes set by ChildEnv
+// env SLOG_CONTEXT_ATTRS is a JSON object of attributes
+// env SLOG_PARENT_PID is added as parent_pid
+func childAttrs() ([]slog.Attr, error) {
+	var attrs []slog.Attr
+
+	if e := os.Getenv("SLOG_CONTEXT_ATTRS"); e != "" {
+		dec := json.NewDecoder(bytes.NewReader([]byte(e)))
+		dec.UseNumber()
+		m := map[string]any{}
+		if err := dec.Decode(&m); err != nil {
+			return nil, fmt.Errorf("SLOG_CONTEXT_ATTRS: %+q unparsable: %w", e, err)
+		}
+		for _, k := range slices.Sorted(maps.Keys(m)) {
+			v := m[k]
+			if n, ok := v.(json.Number); ok {
+				if i, err := n.Int64(); err == nil {
+					v = i
+				} else {
+					v, _ = n.Float64()
+				}
+			}
+			attrs = append(attrs, slog.Any(k, v))
+		}
+	}
+
+	if e := os.Getenv("SLOG_PARENT_PID"); e != "" {
+		pid, err := strconv.Atoi(e)
+		if err != nil {
+			return nil, fmt.Errorf("SLOG_PARENT_PID: %+q unparsable: %w", e, err)
+		}
+		attrs = append(attrs, slog.Int("parent_pid", pid))
+	}
+
+	return attrs, nil
+}
@@ -0,0 +1,67 @@
+package loginit_test
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/croepha/go-logging-extras/logctx"
+	"github.com/croepha/go-logging-extras/loginit"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChildEnv(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.log")
+	t.Setenv("SLOG_OUTPUT", out)
+	t.Setenv("SLOG_LEVEL", "warn")
+	t.Setenv("SLOG_DEBUG_WHEN", "")
+	defer logctx.SetDefaultHandler(logctx.Default().DefaultHandler())
+	t.Cleanup(loginit.ResetDebugWhen)
+
+	ctx := logctx.WithRequestID(context.Background(), "req-1")
+	ctx = logctx.Attr(ctx, "attempt", 3)
+	ctx = logctx.Attr(ctx, "not_passed", "foo")
+
+	env := loginit.ChildEnv(ctx, logctx.RequestIDKey.Name(), "attempt")
+	require.Equal(t, []string{
+		"SLOG_LEVEL=warn",
+		"SLOG_OUTPUT=" + out,
+		"SLOG_DEBUG_WHEN=",
+		`SLOG_CONTEXT_ATTRS={"attempt":3,"request_id":"req-1"}`,
+		"SLOG_PARENT_PID=" + strconv.Itoa(os.Getpid()),
+	}, env)
+
+	// Like a child process started with env
+	for _, kv := range env {
+		k, v, _ := strings.Cut(kv, "=")
+		t.Setenv(k, v)
+	}
+	child := loginit.MustInit(context.Background())
+	require.NoError(t, loginit.SetDebugWhen("request_id=req-1"))
+	require.Contains(t, loginit.ChildEnv(child), "SLOG_DEBUG_WHEN=request_id=req-1")
+
+	require.Equal(t, "req-1", logctx.RequestID(child))
+
+	logctx.Warn(child, "child test")
+	slog.Warn("slog test")
+	logctx.Warn(context.Background(), "other context test")
+
+	b, err := os.ReadFile(out)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	require.Len(t, lines, 3)
+	for i, msg := range []string{"child test", "slog test", "other context test"} {
+		m := map[string]any{}
+		require.NoError(t, json.Unmarshal([]byte(lines[i]), &m))
+		require.Equal(t, msg, m["msg"])
+		require.Equal(t, "req-1", m["request_id"])
+		require.Equal(t, float64(3), m["attempt"])
+		require.Equal(t, float64(os.Getpid()), m["parent_pid"])
+		require.Equal(t, 1, strings.Count(lines[i], `"request_id"`), "added once")
+	}
+}
@@ -0,0 +1,6 @@
+package loginit
+
+// Undoes the SetDebugWhen state of Init, so tests can run more than once
+func ResetDebugWhen() {
+	debugWhen.Store(nil)
+}
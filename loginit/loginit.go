@@ -7,6 +7,7 @@ import (
 	"log/slog"
 	"os"
 	"strings"
+	"sync/atomic"
 
 	"github.com/croepha/go-logging-extras/ctxhandler"
 	"github.com/croepha/go-logging-extras/logctx"
@@ -16,7 +17,8 @@ import (
 // TODO: It would be nice if we could connect slog to t.Log when running tests...
 
 // Perform some common startup things for slogs default logger
-// mutates global state without a lock, please serialize
+// records logged with logctx before Init are replayed into the configured handler
+// the logctx defaults are swapped atomically, but Init should still only be called once
 func Init(ctx context.Context) (context.Context, error) {
 
 	handler, err := EnvHandler()
@@ -24,20 +26,71 @@ func Init(ctx context.Context) (context.Context, error) {
 		return ctx, err
 	}
 
+	attrs, err := childAttrs()
+	if err != nil {
+		return ctx, err
+	}
+
 	if os.Getenv("DEVELOPMENT_MODE") == "1" {
-		logctx.PanicOnNullHandler = true
+		logctx.SetPanicOnNullHandler(true)
+	}
+
+	if e := os.Getenv("SLOG_PPROF_LABELS"); e != "" {
+		logctx.SetProfileLabels(strings.Split(e, ",")...)
 	}
 
-	logctx.DefaultHandler = handler
+	switch e := os.Getenv("SLOG_NULL_HANDLER"); strings.ToLower(e) {
+	case "":
+	case "drop":
+		logctx.SetNullHandlerMode(logctx.NullDrop)
+	case "panic":
+		logctx.SetNullHandlerMode(logctx.NullPanic)
+	case "warn":
+		logctx.SetNullHandlerMode(logctx.NullWarn)
+	default:
+		return ctx, fmt.Errorf("SLOG_NULL_HANDLER: %+q should be drop, panic or warn", e)
+	}
+
+	if h, ok := handler.(*logctx.WhenHandler); ok {
+		debugWhen.Store(h)
+	}
+
+	// Records logged with other contexts carry the attributes from the parent process too
+	if len(attrs) > 0 {
+		logctx.SetDefaultHandler(handler.WithAttrs(attrs))
+	} else {
+		logctx.SetDefaultHandler(handler)
+	}
 
 	// Setup the ctx compatibility handler
-	slog.SetDefault(slog.New(ctxhandler.NewHandler()))
+	slog.SetDefault(slog.New(ctxhandler.NewHandler(nil)))
 
+	// Added with WithAttrs instead of using the default handler, so they can be read back,
+	// ie: with logctx.RequestID
 	ctx = logctx.Context(ctx, handler)
+	ctx = logctx.WithAttrs(ctx, attrs...)
 
 	return ctx, nil
 }
 
+// Set by Init, read by SetDebugWhen and ChildEnv
+var debugWhen atomic.Pointer[logctx.WhenHandler]
+
+// Replaces the SLOG_DEBUG_WHEN rules at runtime, see EnvHandler for the syntax
+// Init must have been called first
+func SetDebugWhen(rules string) error {
+	wh := debugWhen.Load()
+	if wh == nil {
+		return fmt.Errorf("SetDebugWhen: Init has not been called")
+	}
+	r, err := logctx.ParseWhenRules(rules)
+	if err != nil {
+		return fmt.Errorf("SetDebugWhen: %w", err)
+	}
+	wh.SetRules(r)
+	return nil
+}
+
 // Like Init, but panics on any errors
 func MustInit(ctx context.Context) context.Context {
 	ctx, err := Init(ctx)
@@ -51,6 +104,15 @@ func MustInit(ctx context.Context) context.Context {
 // examples: SLOG_LEVEL=debug SLOG_LEVEL=info
 // env SLOG_OUTPUT sets the output
 // it is set to a path that contains at-least one path separator or stdout or stderr
+// env SLOG_DEBUG_WHEN enables debug records for contexts carrying matching attributes
+// examples: SLOG_DEBUG_WHEN=tenant=acme,user_id=42 SLOG_DEBUG_WHEN="tenant=acme;tenant=umbrella"
+// see logctx.ParseWhenRules for details, can be changed at runtime with SetDebugWhen
+// env SLOG_NULL_HANDLER sets what happens when logging with a context that has no handler,
+// one of drop, panic or warn, see logctx.SetNullHandlerMode.  Read by Init
+// env SLOG_TRACE=1 also emits records as runtime/trace log events, see logctx.NewTraceHandler
+// env SLOG_PPROF_LABELS=tenant,endpoint also adds these context attributes as pprof labels,
+// see logctx.SetProfileLabels.  Read by Init
+// env SLOG_CONTEXT_ATTRS and SLOG_PARENT_PID are set by ChildEnv and read by Init
 // other env vars starting with `SLOG_` may be used in the future
 func EnvHandler() (slog.Handler, error) {
 	var level slog.Level
@@ -61,6 +123,11 @@ func EnvHandler() (slog.Handler, error) {
 		}
 	}
 
+	whenRules, err := logctx.ParseWhenRules(os.Getenv("SLOG_DEBUG_WHEN"))
+	if err != nil {
+		return nil, fmt.Errorf("SLOG_DEBUG_WHEN: %w", err)
+	}
+
 	text := true
 
 	var out io.Writer
@@ -92,9 +159,19 @@ func EnvHandler() (slog.Handler, error) {
 		AddSource: true,
 	}
 
+	var handler slog.Handler
 	if text {
-		return slog.NewTextHandler(out, &opts), nil
+		handler = slog.NewTextHandler(out, &opts)
+	} else {
+		handler = slog.NewJSONHandler(out, &opts)
 	}
-	return slog.NewJSONHandler(out, &opts), nil
+
+	if os.Getenv("SLOG_TRACE") == "1" {
+		handler = logctx.NewTraceHandler(handler)
+	}
+
+	wh := logctx.NewWhenHandler(handler, slog.LevelDebug)
+	wh.SetRules(whenRules)
+	return wh, nil
 
 }
@@ -0,0 +1,61 @@
+package loginit_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/croepha/go-logging-extras/logctx"
+	"github.com/croepha/go-logging-extras/loginit"
+	"github.com/croepha/go-logging-extras/logtest"
+	"github.com/stretchr/testify/require"
+)
+
+// Init is slower than the early handler's dumpAfter
+func TestInitAfterEarlyDump(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.log")
+	t.Setenv("SLOG_OUTPUT", out)
+	t.Setenv("SLOG_LEVEL", "info")
+	t.Setenv("SLOG_DEBUG_WHEN", "")
+	defer logctx.SetDefaultHandler(logctx.Default().DefaultHandler())
+	t.Cleanup(loginit.ResetDebugWhen)
+	defer logctx.Default().SetEarlyHandler(logctx.Default().EarlyHandler())
+	logctx.Default().SetEarlyHandler(logctx.NewEarlyHandler(10, time.Millisecond))
+
+	prevStderr := os.Stderr
+	pr, pw, err := os.Pipe()
+	require.NoError(t, err)
+	os.Stderr = pw
+	defer func() { os.Stderr = prevStderr }()
+
+	// ie: a package level context
+	ctx := logctx.Attr(context.Background(), "attr0", "foo")
+	logctx.Info(ctx, "before init")
+	require.Eventually(t, func() bool {
+		_, ok := logctx.Handler(context.Background()).(*logctx.EarlyHandler)
+		return !ok
+	}, time.Second, time.Millisecond)
+
+	loginit.MustInit(context.Background())
+	logctx.Debug(ctx, "filtered by SLOG_LEVEL")
+	logctx.Info(ctx, "after init")
+
+	os.Stderr = prevStderr
+	require.NoError(t, pw.Close())
+	stderr, err := io.ReadAll(pr)
+	require.NoError(t, err)
+	require.Contains(t, string(stderr), "msg=\"before init\" attr0=foo\n")
+	require.NotContains(t, string(stderr), "after init")
+	require.NotContains(t, string(stderr), "filtered")
+
+	f, err := os.Open(out)
+	require.NoError(t, err)
+	defer f.Close()
+	lines := logtest.JSONLines(t, f)
+	require.Len(t, lines, 1)
+	require.Equal(t, "after init", lines[0]["msg"])
+	require.Equal(t, "foo", lines[0]["attr0"])
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"io"
 	"log/slog"
+	"math"
 	"runtime"
 	"testing"
 
@@ -71,7 +72,7 @@ func (th *testHandler) RequireLineExtra(sourceLineDelta int, sourceSkip int, exp
 	type jsonObject = map[string]any
 
 	expectedBuf := bytes.Buffer{}
-	slog.New(slog.NewJSONHandler(&expectedBuf, nil)).
+	slog.New(slog.NewJSONHandler(&expectedBuf, &slog.HandlerOptions{Level: slog.Level(math.MinInt)})).
 		Log(context.Background(), expectedLevel, expectedMsg, expectedArgs...)
 	expected := jsonObject{}
 	require.NoError(th.t, json.Unmarshal(expectedBuf.Bytes(), &expected))
@@ -101,3 +102,17 @@ func (th *testHandler) RequireLineExtra(sourceLineDelta int, sourceSkip int, exp
 
 	require.Equal(th.t, expected, actual)
 }
+
+// Decodes the JSON objects read from r, ie: the output of slog.JSONHandler
+// Reading a bytes.Buffer consumes it, so it can be called again for the following records
+func JSONLines(t *testing.T, r io.Reader) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	dec := json.NewDecoder(r)
+	for dec.More() {
+		line := map[string]any{}
+		require.NoError(t, dec.Decode(&line))
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -1,10 +1,12 @@
 package logtest_test
 
 import (
+	"bytes"
 	"log/slog"
 	"testing"
 
 	"github.com/croepha/go-logging-extras/logtest"
+	"github.com/stretchr/testify/require"
 )
 
 func TestTestHandler(t *testing.T) {
@@ -15,3 +17,20 @@ func TestTestHandler(t *testing.T) {
 	th.RequireLine(slog.LevelInfo, "test message", "attr0", "foo", "attr1", "bar")
 
 }
+
+func TestJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	l.Info("first", "attr0", "foo")
+	l.Warn("second")
+	lines := logtest.JSONLines(t, &buf)
+	require.Len(t, lines, 2)
+	require.Equal(t, "first", lines[0]["msg"])
+	require.Equal(t, "foo", lines[0]["attr0"])
+	require.Equal(t, "WARN", lines[1]["level"])
+
+	require.Empty(t, logtest.JSONLines(t, &buf))
+	l.Info("third")
+	require.Len(t, logtest.JSONLines(t, &buf), 1)
+}